@@ -1,5 +1,16 @@
 package dqk
 
+import (
+	"errors"
+	"slices"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// ErrAccessRestricted is returned when the user has neither the base nor the elevated permission
+var ErrAccessRestricted = errors.New("access restricted")
+
 // HasPermission checks whether the user has a specific permission.
 // It takes a permission key (e.g., "view:users") and a map of the user's permissions,
 // where each key represents a granted permission and the value is typically true.
@@ -53,3 +64,186 @@ func BuildPermissionSet(userPermissions []string) map[string]bool {
 	}
 	return permMap
 }
+
+// OwnershipCondition returns the row scoping condition for a user based on their permissions.
+//
+// Users with the elevated permission see every row so the condition is nil.
+// Users with only the base permission see the rows where ownerColumn equals ownerValue.
+// Users with neither get ErrAccessRestricted.
+//
+// The condition can be used with any builder, ie. sq.UpdateBuilder or sq.DeleteBuilder.
+//
+// Example:
+//
+//	cond, err := OwnershipCondition(userPerms, "edit:article", "editAll:articles", "articles.author_id", userID)
+//	// cond → articles.author_id = ? for users with edit:article only
+func OwnershipCondition(perms map[string]bool, basePerm, elevatedPerm, ownerColumn string, ownerValue any) (sq.Sqlizer, error) {
+	if HasPermission(elevatedPerm, perms) {
+		return nil, nil
+	}
+	if HasPermission(basePerm, perms) {
+		return sq.Eq{ownerColumn: ownerValue}, nil
+	}
+	return nil, ErrAccessRestricted
+}
+
+// ScopeByOwnership adds the row scoping condition of OwnershipCondition to a select query.
+//
+// Returns the query unchanged for users with the elevated permission, the query with
+// WHERE ownerColumn = ownerValue for users with the base permission and ErrAccessRestricted
+// with the query unchanged for anyone else.
+//
+// Example:
+//
+//	q, err := ScopeByOwnership(q, userPerms, "view:article", "viewAll:articles", "articles.author_id", userID)
+//	if errors.Is(err, ErrAccessRestricted) {
+//		// respond with 403
+//	}
+func ScopeByOwnership(q sq.SelectBuilder, perms map[string]bool, basePerm, elevatedPerm, ownerColumn string, ownerValue any) (sq.SelectBuilder, error) {
+	cond, err := OwnershipCondition(perms, basePerm, elevatedPerm, ownerColumn, ownerValue)
+	if err != nil {
+		return q, err
+	}
+	if cond == nil {
+		return q, nil
+	}
+	return q.Where(cond), nil
+}
+
+// PermissionMatcher checks permissions against a compiled set of grants supporting wildcards,
+// implications and denials. It is safe for concurrent use once built with NewPermissionMatcher.
+//
+// Permissions are split in segments on ":". A "*" segment matches any single segment, and as the last
+// segment it matches all the remaining ones, so "users:*" matches "users:read" & "users:posts:read"
+// and "*" alone matches every permission.
+//
+// Implications grant extra permissions, their keys are either a whole permission or a single segment:
+//
+//	implications := map[string][]string{
+//		"edit":  {"view"},   // edit:users → view:users
+//		"admin": {"*"},      // admin → every permission
+//	}
+//
+// Permissions prefixed with "!" are denials and always win over grants, ie. "!delete:users".
+type PermissionMatcher struct {
+	grants  *permissionNode
+	denials *permissionNode
+}
+
+// permissionNode is a segment trie of permissions
+type permissionNode struct {
+	children map[string]*permissionNode
+	// terminal is true when a permission ends at this node
+	terminal bool
+}
+
+// NewPermissionMatcher compiles the permissions and their implications into a PermissionMatcher
+//
+// Example:
+//
+//	m := NewPermissionMatcher([]string{"users:*", "edit:posts", "!users:delete"}, map[string][]string{"edit": {"view"}})
+//	m.HasPermission("users:read")   // true
+//	m.HasPermission("view:posts")   // true
+//	m.HasPermission("users:delete") // false
+func NewPermissionMatcher(permissions []string, implications map[string][]string) *PermissionMatcher {
+	m := &PermissionMatcher{grants: &permissionNode{}, denials: &permissionNode{}}
+
+	granted := map[string]bool{}
+	pending := []string{}
+	for _, permission := range permissions {
+		permission = strings.TrimSpace(permission)
+		if denied, ok := strings.CutPrefix(permission, "!"); ok {
+			m.denials.insert(denied)
+			continue
+		}
+		pending = append(pending, permission)
+	}
+
+	for len(pending) > 0 {
+		permission := pending[0]
+		pending = pending[1:]
+		if permission == "" || granted[permission] {
+			continue
+		}
+		granted[permission] = true
+		m.grants.insert(permission)
+
+		pending = append(pending, implications[permission]...)
+		segments := strings.Split(permission, ":")
+		if len(segments) == 1 {
+			continue
+		}
+		for index, segment := range segments {
+			for _, implied := range implications[segment] {
+				replaced := slices.Clone(segments)
+				replaced[index] = implied
+				pending = append(pending, strings.Join(replaced, ":"))
+			}
+		}
+	}
+	return m
+}
+
+// HasPermission returns true if the permission is granted and not denied
+func (m *PermissionMatcher) HasPermission(access string) bool {
+	if m == nil || access == "" {
+		return false
+	}
+	segments := strings.Split(access, ":")
+	return m.grants.match(segments) && !m.denials.match(segments)
+}
+
+// IsAccessRestricted works like the IsAccessRestricted function with the matcher permissions
+func (m *PermissionMatcher) IsAccessRestricted(basePerm, elevatedPerm string) bool {
+	return !m.HasPermission(basePerm) && !m.HasPermission(elevatedPerm)
+}
+
+// PermissionSet resolves the given permissions with the matcher into a map that can be used
+// with HasPermission and the other map based helpers, ie. ScopeByOwnership or PermittedFilters
+//
+// Example:
+//
+//	perms := m.PermissionSet("view:article", "viewAll:articles")
+//	q, err := ScopeByOwnership(q, perms, "view:article", "viewAll:articles", "articles.author_id", userID)
+func (m *PermissionMatcher) PermissionSet(permissions ...string) map[string]bool {
+	permMap := make(map[string]bool, len(permissions))
+	for _, permission := range permissions {
+		permMap[permission] = m.HasPermission(permission)
+	}
+	return permMap
+}
+
+func (n *permissionNode) insert(permission string) {
+	if permission == "" {
+		return
+	}
+	node := n
+	for _, segment := range strings.Split(permission, ":") {
+		if node.children == nil {
+			node.children = map[string]*permissionNode{}
+		}
+		child, ok := node.children[segment]
+		if !ok {
+			child = &permissionNode{}
+			node.children[segment] = child
+		}
+		node = child
+	}
+	node.terminal = true
+}
+
+func (n *permissionNode) match(segments []string) bool {
+	if len(segments) == 0 {
+		return n.terminal
+	}
+	if child, ok := n.children[segments[0]]; ok && child.match(segments[1:]) {
+		return true
+	}
+	if wildcard, ok := n.children["*"]; ok {
+		// a trailing wildcard matches all the remaining segments
+		if wildcard.terminal || wildcard.match(segments[1:]) {
+			return true
+		}
+	}
+	return false
+}
@@ -3,6 +3,7 @@ package dqk
 import (
 	"testing"
 
+	sq "github.com/Masterminds/squirrel"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -131,3 +132,91 @@ func TestBuildPermissionSet(t *testing.T) {
 		})
 	}
 }
+
+func TestScopeByOwnership(t *testing.T) {
+	tests := []struct {
+		name         string
+		permissions  map[string]bool
+		expectedSQL  string
+		expectedArgs []any
+		expectedErr  error
+	}{
+		{
+			name:         "elevated permission sees everything",
+			permissions:  BuildPermissionSet([]string{"view:article", "viewAll:articles"}),
+			expectedSQL:  "SELECT articles.id FROM articles",
+			expectedArgs: nil,
+		},
+		{
+			name:         "base permission sees own rows",
+			permissions:  BuildPermissionSet([]string{"view:article"}),
+			expectedSQL:  "SELECT articles.id FROM articles WHERE articles.author_id = $1",
+			expectedArgs: []any{42},
+		},
+		{
+			name:         "no permission",
+			permissions:  map[string]bool{"view:article": false},
+			expectedSQL:  "SELECT articles.id FROM articles",
+			expectedArgs: nil,
+			expectedErr:  ErrAccessRestricted,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := sq.Select("articles.id").From("articles").PlaceholderFormat(sq.Dollar)
+			q, err := ScopeByOwnership(q, tt.permissions, "view:article", "viewAll:articles", "articles.author_id", 42)
+			assert.ErrorIs(t, err, tt.expectedErr)
+			sql, args, err := q.ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestPermissionMatcher(t *testing.T) {
+	implications := map[string][]string{
+		"edit":      {"view"},
+		"viewAll":   {"view"},
+		"superuser": {"*"},
+	}
+	tests := []struct {
+		name        string
+		permissions []string
+		access      string
+		expected    bool
+	}{
+		{name: "exact", permissions: []string{"view:users"}, access: "view:users", expected: true},
+		{name: "missing", permissions: []string{"view:users"}, access: "edit:users", expected: false},
+		{name: "trailing wildcard", permissions: []string{"users:*"}, access: "users:read", expected: true},
+		{name: "trailing wildcard nested", permissions: []string{"users:*"}, access: "users:posts:read", expected: true},
+		{name: "trailing wildcard other resource", permissions: []string{"users:*"}, access: "posts:read", expected: false},
+		{name: "leading wildcard", permissions: []string{"*:read"}, access: "users:read", expected: true},
+		{name: "leading wildcard other action", permissions: []string{"*:read"}, access: "users:write", expected: false},
+		{name: "everything", permissions: []string{"*"}, access: "delete:users", expected: true},
+		{name: "segment implication", permissions: []string{"edit:posts"}, access: "view:posts", expected: true},
+		{name: "implication is not reversed", permissions: []string{"view:posts"}, access: "edit:posts", expected: false},
+		{name: "whole implication", permissions: []string{"superuser"}, access: "delete:users", expected: true},
+		{name: "denial wins", permissions: []string{"users:*", "!users:delete"}, access: "users:delete", expected: false},
+		{name: "denial other permission", permissions: []string{"users:*", "!users:delete"}, access: "users:read", expected: true},
+		{name: "wildcard denial", permissions: []string{"superuser", "!*:delete"}, access: "posts:delete", expected: false},
+		{name: "denied implication", permissions: []string{"edit:posts", "!view:posts"}, access: "view:posts", expected: false},
+		{name: "empty access", permissions: []string{"*"}, access: "", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewPermissionMatcher(tt.permissions, implications)
+			assert.Equal(t, tt.expected, m.HasPermission(tt.access))
+		})
+	}
+}
+
+func TestPermissionMatcherAccessRestricted(t *testing.T) {
+	m := NewPermissionMatcher([]string{"viewAll:*"}, map[string][]string{"viewAll": {"view"}})
+	assert.False(t, m.IsAccessRestricted("view:article", "viewAll:articles"))
+	assert.True(t, m.IsAccessRestricted("edit:article", "editAll:articles"))
+	assert.Equal(t, map[string]bool{"view:article": true, "edit:article": false}, m.PermissionSet("view:article", "edit:article"))
+
+	var nilMatcher *PermissionMatcher
+	assert.True(t, nilMatcher.IsAccessRestricted("view:article", "viewAll:articles"))
+}
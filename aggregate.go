@@ -0,0 +1,100 @@
+package dqk
+
+import (
+	"strings"
+	"sync"
+)
+
+var aggregateFunctions = struct {
+	sync.RWMutex
+	names map[string]bool
+}{
+	names: map[string]bool{
+		"count":            true,
+		"sum":              true,
+		"min":              true,
+		"max":              true,
+		"avg":              true,
+		"stddev":           true,
+		"stddev_pop":       true,
+		"stddev_samp":      true,
+		"variance":         true,
+		"var_pop":          true,
+		"var_samp":         true,
+		"group_concat":     true,
+		"string_agg":       true,
+		"array_agg":        true,
+		"json_agg":         true,
+		"jsonb_agg":        true,
+		"json_arrayagg":    true,
+		"json_objectagg":   true,
+		"json_group_array": true,
+		"listagg":          true,
+		"bool_and":         true,
+		"bool_or":          true,
+		"bit_and":          true,
+		"bit_or":           true,
+		"bit_xor":          true,
+		"every":            true,
+		"percentile_cont":  true,
+		"percentile_disc":  true,
+		"mode":             true,
+	},
+}
+
+// RegisterAggregateFunctions adds custom aggregate function names (ie. user defined aggregates)
+// to the registry used to detect filters that belong in a HAVING clause. Names are case insensitive.
+func RegisterAggregateFunctions(names ...string) {
+	aggregateFunctions.Lock()
+	defer aggregateFunctions.Unlock()
+	for _, name := range names {
+		aggregateFunctions.names[strings.ToLower(strings.TrimSpace(name))] = true
+	}
+}
+
+// IsAggregateFunction returns true if name is a registered aggregate function
+func IsAggregateFunction(name string) bool {
+	aggregateFunctions.RLock()
+	defer aggregateFunctions.RUnlock()
+	return aggregateFunctions.names[strings.ToLower(name)]
+}
+
+// expressionClause detects the clause an SQL expression can be filtered in.
+// Window function calls (a call followed by OVER) belong in QUALIFY, calls to
+// registered aggregates in HAVING, everything else in WHERE.
+func expressionClause(expr string) string {
+	tokens := tokenizeSQL(expr)
+	clause := TokenWhere
+
+	for i, token := range tokens {
+		if token.kind != sqlIdent || !tokens.isPunct(i+1, "(") || tokens.isPunct(i-1, ".") {
+			continue
+		}
+		if tokens.isWindowCall(i + 1) {
+			return TokenQualify
+		}
+		if IsAggregateFunction(token.value) {
+			clause = TokenHaving
+		}
+	}
+	return clause
+}
+
+// isWindowCall reports whether the call whose arguments open at index open is followed by OVER.
+// FILTER (...) and WITHIN GROUP (...) are allowed between the call and OVER.
+func (t sqlTokens) isWindowCall(open int) bool {
+	next := t.closingParen(open) + 1
+	for next < len(t) {
+		switch {
+		case t.isKeyword(next, "over"):
+			return true
+		case t.isKeyword(next, "filter") && t.isPunct(next+1, "("):
+			next = t.closingParen(next+1) + 1
+		case t.isKeyword(next, "within") && t.isKeyword(next+1, "group") && t.isPunct(next+2, "("):
+			next = t.closingParen(next+2) + 1
+		default:
+			return false
+		}
+	}
+	return false
+}
@@ -0,0 +1,41 @@
+package dqk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRegisterAggregateFunctions(t *testing.T) {
+	filter := Filters{Name: "median", Operator: ">", DbField: "MEDIAN_PRICE(cars.price)"}
+	assert.False(t, filter.IsAggregate())
+
+	RegisterAggregateFunctions("median_price")
+	assert.True(t, IsAggregateFunction("MEDIAN_PRICE"))
+	assert.True(t, filter.IsAggregate())
+}
+
+func TestExpressionClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		expr     string
+		expected string
+	}{
+		{name: "empty", expr: "", expected: TokenWhere},
+		{name: "column", expr: "cars.price", expected: TokenWhere},
+		{name: "non aggregate function", expr: "LOWER(cars.name)", expected: TokenWhere},
+		{name: "aggregate", expr: "count(DISTINCT cars.id)", expected: TokenHaving},
+		{name: "aggregate with newline", expr: "SUM\n(cars.price)", expected: TokenHaving},
+		{name: "aggregate in comment", expr: "cars.price /* sum(price) */", expected: TokenWhere},
+		{name: "aggregate in line comment", expr: "cars.price -- sum(price)", expected: TokenWhere},
+		{name: "quoted identifier", expr: `"sum"(cars.price)`, expected: TokenWhere},
+		{name: "escaped quote in literal", expr: "CONCAT('it''s sum(', cars.name)", expected: TokenWhere},
+		{name: "window", expr: "rank() over (order by cars.price)", expected: TokenQualify},
+		{name: "aggregate next to window", expr: "SUM(cars.price) - LAG(SUM(cars.price)) OVER (ORDER BY cars.year)", expected: TokenQualify},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, expressionClause(tt.expr))
+		})
+	}
+}
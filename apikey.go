@@ -0,0 +1,279 @@
+package dqk
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/SteliosGiannatos/DynamicQueryKit/caching"
+)
+
+const apiKeyKey contextKey = "dqk_api_key"
+
+// ErrAPIKeyNotFound is returned by an APIKeyStore when no key matches the hash
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+// APIKey is a stored API key. Only the hash of the key is stored (see HashAPIKey).
+// Scopes are the permissions of the key, ie. "view:users"
+type APIKey struct {
+	ID        string     `json:"id" xml:"id" yaml:"id" csv:"id"`
+	Hash      string     `json:"hash" xml:"hash" yaml:"hash" csv:"hash"`
+	Subject   string     `json:"subject" xml:"subject" yaml:"subject" csv:"subject"`
+	Scopes    []string   `json:"scopes" xml:"scopes" yaml:"scopes" csv:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at" xml:"expires_at" yaml:"expires_at" csv:"expires_at"`
+}
+
+// APIKeyStore looks up API keys by their hash. It returns ErrAPIKeyNotFound for unknown keys.
+type APIKeyStore interface {
+	LookupAPIKey(ctx context.Context, hash string) (*APIKey, error)
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of the key, the format expected by every APIKeyStore
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// MemoryAPIKeyStore keeps API keys in memory. It is safe for concurrent use.
+type MemoryAPIKeyStore struct {
+	mu   sync.RWMutex
+	keys []APIKey
+}
+
+// NewMemoryAPIKeyStore returns a MemoryAPIKeyStore with the keys
+func NewMemoryAPIKeyStore(keys ...APIKey) *MemoryAPIKeyStore {
+	return &MemoryAPIKeyStore{keys: keys}
+}
+
+// Add stores a key
+func (s *MemoryAPIKeyStore) Add(key APIKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, key)
+}
+
+// LookupAPIKey implements APIKeyStore. Every key is compared so the lookup time does not depend on the match.
+func (s *MemoryAPIKeyStore) LookupAPIKey(_ context.Context, hash string) (*APIKey, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var found *APIKey
+	for i := range s.keys {
+		if subtle.ConstantTimeCompare([]byte(s.keys[i].Hash), []byte(hash)) == 1 && found == nil {
+			key := s.keys[i]
+			found = &key
+		}
+	}
+	if found == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+	return found, nil
+}
+
+// SQLAPIKeyStore looks up API keys in a table through database/sql. Scopes are stored
+// as a comma or space separated string and ExpiresAt as a nullable timestamp.
+type SQLAPIKeyStore struct {
+	// DB is usually a *sql.DB
+	DB    sq.BaseRunner
+	Table string
+	// Placeholder is the placeholder format of the driver, sq.Question by default
+	Placeholder sq.PlaceholderFormat
+	// Column names, by default id, key_hash, subject, scopes & expires_at
+	IDColumn        string
+	HashColumn      string
+	SubjectColumn   string
+	ScopesColumn    string
+	ExpiresAtColumn string
+}
+
+// LookupAPIKey implements APIKeyStore
+func (s *SQLAPIKeyStore) LookupAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	placeholder := s.Placeholder
+	if placeholder == nil {
+		placeholder = sq.Question
+	}
+	hashColumn := valueOrDefault(s.HashColumn, "key_hash")
+
+	q := sq.Select(
+		valueOrDefault(s.IDColumn, "id"),
+		hashColumn,
+		valueOrDefault(s.SubjectColumn, "subject"),
+		valueOrDefault(s.ScopesColumn, "scopes"),
+		valueOrDefault(s.ExpiresAtColumn, "expires_at"),
+	).From(s.Table).Where(sq.Eq{hashColumn: hash}).Limit(1).PlaceholderFormat(placeholder).RunWith(s.DB)
+
+	var (
+		key       APIKey
+		subject   sql.NullString
+		scopes    sql.NullString
+		expiresAt sql.NullTime
+	)
+	err := q.QueryRowContext(ctx).Scan(&key.ID, &key.Hash, &subject, &scopes, &expiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("looking up api key: %w", err)
+	}
+
+	key.Subject = subject.String
+	key.Scopes = strings.FieldsFunc(scopes.String, func(r rune) bool { return r == ',' || r == ' ' })
+	if expiresAt.Valid {
+		key.ExpiresAt = &expiresAt.Time
+	}
+	return &key, nil
+}
+
+// DefaultAPIKeyCacheTTL is how long CacheAPIKeyStore caches the keys of its Store when it has no TTL.
+// A revoked key stays valid for up to this long unless it is removed with Revoke
+const DefaultAPIKeyCacheTTL = 5 * time.Minute
+
+// CacheAPIKeyStore caches the keys of another store in a caching.Cache. Without a Store
+// the cache is the only source and the keys must be added with Set.
+// Call Revoke when a key is revoked or deleted from the Store.
+type CacheAPIKeyStore struct {
+	Cache caching.Cache
+	Store APIKeyStore
+	// TTL of the cached keys. When nil keys looked up from the Store are cached for DefaultAPIKeyCacheTTL
+	// and keys added with Set use the cache default
+	TTL *time.Duration
+}
+
+// Set stores a key in the cache
+func (s *CacheAPIKeyStore) Set(key APIKey) error {
+	data, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return s.Cache.SetKey(apiKeyCacheKey(key.Hash), string(data), s.TTL)
+}
+
+// LookupAPIKey implements APIKeyStore
+func (s *CacheAPIKeyStore) LookupAPIKey(ctx context.Context, hash string) (*APIKey, error) {
+	if data, err := s.Cache.Get(apiKeyCacheKey(hash)); err == nil && len(data) > 0 {
+		var key APIKey
+		if err := json.Unmarshal(data, &key); err == nil {
+			return &key, nil
+		}
+	}
+	if s.Store == nil {
+		return nil, ErrAPIKeyNotFound
+	}
+
+	key, err := s.Store.LookupAPIKey(ctx, hash)
+	if err != nil {
+		return nil, err
+	}
+	ttl := s.TTL
+	if ttl == nil {
+		defaultTTL := DefaultAPIKeyCacheTTL
+		ttl = &defaultTTL
+	}
+	data, err := json.Marshal(key)
+	if err == nil {
+		err = s.Cache.SetKey(apiKeyCacheKey(hash), string(data), ttl)
+	}
+	if err != nil {
+		slog.LogAttrs(ctx, slog.LevelWarn, "failed to cache api key", slog.String("method", "CacheAPIKeyStore.LookupAPIKey"), slog.String("error", err.Error()))
+	}
+	return key, nil
+}
+
+// Revoke removes a key from the cache so it is looked up from the Store again
+func (s *CacheAPIKeyStore) Revoke(hash string) error {
+	if _, err := s.Cache.Delete(apiKeyCacheKey(hash)); err != nil {
+		return fmt.Errorf("revoking api key: %w", err)
+	}
+	return nil
+}
+
+func apiKeyCacheKey(hash string) string {
+	return "apikey:" + hash
+}
+
+// APIKeyConfig configures APIKeyAuth
+type APIKeyConfig struct {
+	Store APIKeyStore
+	// Header holding the key, X-API-Key by default
+	Header string
+	// QueryParam holding the key, keys are not read from the query string when empty.
+	// Add it to the CacheRoute.PrivateParams of cached routes unless it is api_key
+	QueryParam string
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+}
+
+// APIKeyAuth authenticates requests with an API key from the header or the query param of the config.
+// The key is hashed with HashAPIKey, looked up in the store and compared in constant time.
+// The subject (or the key ID) and the scopes as a permission set are stored in the request context
+// so they work with RequirePermission and PermissionsFromContext. Requests without a valid key get 401.
+//
+// Example:
+//
+//	store := NewMemoryAPIKeyStore(APIKey{ID: "ci", Hash: HashAPIKey(os.Getenv("CI_KEY")), Scopes: []string{"view:builds"}})
+//	stack := CreateStack(Logging, APIKeyAuth(APIKeyConfig{Store: store}), RequirePermission("view:builds"))
+func APIKeyAuth(config APIKeyConfig) Middleware {
+	header := valueOrDefault(config.Header, "X-API-Key")
+	now := config.Now
+	if now == nil {
+		now = time.Now
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			raw := r.Header.Get(header)
+			if raw == "" && config.QueryParam != "" {
+				raw = r.URL.Query().Get(config.QueryParam)
+			}
+			if raw == "" {
+				writeErrorResponse(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+
+			hash := HashAPIKey(raw)
+			key, err := config.Store.LookupAPIKey(r.Context(), hash)
+			if err != nil {
+				if !errors.Is(err, ErrAPIKeyNotFound) {
+					slog.LogAttrs(r.Context(), slog.LevelError, "api key lookup failed", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+				}
+				writeErrorResponse(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+			if subtle.ConstantTimeCompare([]byte(key.Hash), []byte(hash)) != 1 || (key.ExpiresAt != nil && !now().Before(*key.ExpiresAt)) {
+				writeErrorResponse(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+
+			subject := valueOrDefault(key.Subject, key.ID)
+			AccessLogFromContext(r.Context()).SetSubject(subject)
+			ctx := WithSubject(r.Context(), subject)
+			ctx = WithPermissions(ctx, BuildPermissionSet(key.Scopes))
+			ctx = context.WithValue(ctx, apiKeyKey, key)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// APIKeyFromContext returns the API key authenticated by APIKeyAuth
+func APIKeyFromContext(ctx context.Context) (*APIKey, bool) {
+	key, ok := ctx.Value(apiKeyKey).(*APIKey)
+	return key, ok && key != nil
+}
+
+func valueOrDefault(value, fallback string) string {
+	if value == "" {
+		return fallback
+	}
+	return value
+}
@@ -0,0 +1,176 @@
+package dqk
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeRow struct {
+	values []any
+	err    error
+}
+
+func (r fakeRow) Scan(dest ...any) error {
+	if r.err != nil {
+		return r.err
+	}
+	for i, value := range r.values {
+		switch d := dest[i].(type) {
+		case *string:
+			*d = value.(string)
+		case *sql.NullString:
+			d.Scan(value)
+		case *sql.NullTime:
+			d.Scan(value)
+		}
+	}
+	return nil
+}
+
+type fakeRunner struct {
+	query string
+	args  []any
+	row   fakeRow
+}
+
+func (f *fakeRunner) Exec(string, ...any) (sql.Result, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeRunner) Query(string, ...any) (*sql.Rows, error) {
+	return nil, errors.New("not implemented")
+}
+func (f *fakeRunner) QueryRowContext(_ context.Context, query string, args ...any) sq.RowScanner {
+	f.query, f.args = query, args
+	return f.row
+}
+
+type fakeCache struct {
+	values map[string]string
+	ttls   map[string]*time.Duration
+}
+
+func (c *fakeCache) SetKey(key string, value string, ttl *time.Duration) error {
+	c.values[key] = value
+	if c.ttls != nil {
+		c.ttls[key] = ttl
+	}
+	return nil
+}
+func (c *fakeCache) SetKeyIndex(string, string) error           { return nil }
+func (c *fakeCache) DeleteCacheIndex(string) (int, error)       { return 0, nil }
+func (c *fakeCache) CacheIncrement(string, time.Duration) error { return nil }
+func (c *fakeCache) Delete(keys ...string) (int, error) {
+	deleted := 0
+	for _, key := range keys {
+		if _, ok := c.values[key]; ok {
+			delete(c.values, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+func (c *fakeCache) Get(key string) ([]byte, error) {
+	value, ok := c.values[key]
+	if !ok {
+		return []byte{}, errors.New("cache miss")
+	}
+	return []byte(value), nil
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	expired := time.Now().Add(-time.Hour)
+	store := NewMemoryAPIKeyStore(
+		APIKey{ID: "ci", Hash: HashAPIKey("ci-secret"), Scopes: []string{"view:builds"}},
+		APIKey{ID: "old", Hash: HashAPIKey("old-secret"), Scopes: []string{"view:builds"}, ExpiresAt: &expired},
+	)
+	handler := CreateStack(
+		APIKeyAuth(APIKeyConfig{Store: store, QueryParam: "api_key"}),
+		RequirePermission("view:builds"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, _ := SubjectFromContext(r.Context())
+		key, ok := APIKeyFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "ci", subject)
+		assert.Equal(t, "ci", key.ID)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		target   string
+		expected int
+	}{
+		{name: "header", header: "ci-secret", target: "/builds", expected: http.StatusOK},
+		{name: "query param", target: "/builds?api_key=ci-secret", expected: http.StatusOK},
+		{name: "unknown key", header: "other", target: "/builds", expected: http.StatusUnauthorized},
+		{name: "expired key", header: "old-secret", target: "/builds", expected: http.StatusUnauthorized},
+		{name: "missing key", target: "/builds", expected: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+		})
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	assert.Equal(t, "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b", HashAPIKey("secret"))
+}
+
+func TestSQLAPIKeyStore(t *testing.T) {
+	expiresAt := time.Date(2030, time.January, 1, 0, 0, 0, 0, time.UTC)
+	hash := HashAPIKey("secret")
+	runner := &fakeRunner{row: fakeRow{values: []any{"1", hash, "service", "view:users, edit:users", expiresAt}}}
+	store := &SQLAPIKeyStore{DB: runner, Table: "api_keys", Placeholder: sq.Dollar}
+
+	key, err := store.LookupAPIKey(context.Background(), hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT id, key_hash, subject, scopes, expires_at FROM api_keys WHERE key_hash = $1 LIMIT 1", runner.query)
+	assert.Equal(t, []any{hash}, runner.args)
+	assert.Equal(t, &APIKey{ID: "1", Hash: hash, Subject: "service", Scopes: []string{"view:users", "edit:users"}, ExpiresAt: &expiresAt}, key)
+
+	runner.row = fakeRow{err: sql.ErrNoRows}
+	_, err = store.LookupAPIKey(context.Background(), hash)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+}
+
+func TestCacheAPIKeyStore(t *testing.T) {
+	cache := &fakeCache{values: map[string]string{}, ttls: map[string]*time.Duration{}}
+	hash := HashAPIKey("secret")
+	source := NewMemoryAPIKeyStore(APIKey{ID: "1", Hash: hash, Scopes: []string{"view:users"}})
+	store := &CacheAPIKeyStore{Cache: cache, Store: source}
+
+	key, err := store.LookupAPIKey(context.Background(), hash)
+	assert.NoError(t, err)
+	assert.Equal(t, "1", key.ID)
+	assert.Contains(t, cache.values, "apikey:"+hash)
+	if assert.NotNil(t, cache.ttls["apikey:"+hash]) {
+		assert.Equal(t, DefaultAPIKeyCacheTTL, *cache.ttls["apikey:"+hash])
+	}
+
+	cacheOnly := &CacheAPIKeyStore{Cache: cache}
+	key, err = cacheOnly.LookupAPIKey(context.Background(), hash)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"view:users"}, key.Scopes)
+
+	_, err = cacheOnly.LookupAPIKey(context.Background(), HashAPIKey("other"))
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound)
+	assert.NoError(t, cacheOnly.Revoke(hash))
+	_, err = cacheOnly.LookupAPIKey(context.Background(), hash)
+	assert.ErrorIs(t, err, ErrAPIKeyNotFound, "revoked keys are removed from the cache")
+}
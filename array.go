@@ -0,0 +1,100 @@
+package dqk
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	// OperatorContains matches array columns that contain all the values (postgres @>)
+	OperatorContains = "@>"
+	// OperatorOverlaps matches array columns that contain any of the values (postgres &&)
+	OperatorOverlaps = "&&"
+	// OperatorAny matches scalar columns equal to any of the values, bound as a single array (postgres = ANY(?))
+	OperatorAny = "ANY"
+)
+
+// PgArray is a string slice bound as a postgres array literal ie. {"a","b"}.
+// It works with any driver since the value is sent as text and cast by postgres to the column type.
+type PgArray []string
+
+// Value implements driver.Valuer
+func (a PgArray) Value() (driver.Value, error) {
+	if a == nil {
+		return nil, nil
+	}
+	elements := make([]string, 0, len(a))
+	for _, element := range a {
+		escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(element)
+		elements = append(elements, `"`+escaped+`"`)
+	}
+	return "{" + strings.Join(elements, ",") + "}", nil
+}
+
+// IsArrayOperator returns true for the operators handled by arrayCondition
+func IsArrayOperator(operator string) bool {
+	switch strings.ToUpper(strings.TrimSpace(operator)) {
+	case OperatorContains, OperatorOverlaps, OperatorAny:
+		return true
+	}
+	return false
+}
+
+// arrayCondition collects all values of an array filter in a single condition.
+// Postgres (and filters with no dialect) use native arrays, mysql and sqlite expect JSON array columns:
+//
+//   - @> : postgres col @> ?, mysql JSON_CONTAINS, sqlite counts the matching json_each values
+//   - && : postgres col && ?, mysql JSON_OVERLAPS, sqlite EXISTS over json_each
+//   - ANY: postgres col = ANY(?), mysql & sqlite col IN (...)
+func arrayCondition(filter Filters, values []string) (sq.Sqlizer, error) {
+	unique := []string{}
+	for _, value := range values {
+		if !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	operator := strings.ToUpper(strings.TrimSpace(filter.Operator))
+	column := filter.DbField
+
+	switch filter.Dialect {
+	case DialectMySQL:
+		if operator == OperatorAny {
+			return sq.Eq{column: unique}, nil
+		}
+		encoded, err := json.Marshal(unique)
+		if err != nil {
+			return nil, err
+		}
+		if operator == OperatorContains {
+			return sq.Expr(fmt.Sprintf("JSON_CONTAINS(%s, ?)", column), string(encoded)), nil
+		}
+		return sq.Expr(fmt.Sprintf("JSON_OVERLAPS(%s, ?)", column), string(encoded)), nil
+
+	case DialectSQLite:
+		if operator == OperatorAny {
+			return sq.Eq{column: unique}, nil
+		}
+		args := make([]any, 0, len(unique)+1)
+		for _, value := range unique {
+			args = append(args, value)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(unique)), ",")
+		if operator == OperatorContains {
+			return sq.Expr(fmt.Sprintf("(SELECT COUNT(DISTINCT json_each.value) FROM json_each(%s) WHERE json_each.value IN (%s)) = ?", column, placeholders), append(args, len(unique))...), nil
+		}
+		return sq.Expr(fmt.Sprintf("EXISTS (SELECT 1 FROM json_each(%s) WHERE json_each.value IN (%s))", column, placeholders), args...), nil
+
+	case DialectPostgres, "":
+		if operator == OperatorAny {
+			return sq.Expr(fmt.Sprintf("%s = ANY(?)", column), PgArray(unique)), nil
+		}
+		return sq.Expr(fmt.Sprintf("%s %s ?", column, operator), PgArray(unique)), nil
+	}
+
+	return nil, fmt.Errorf("array operators are not supported for dialect %q", filter.Dialect)
+}
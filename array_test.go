@@ -0,0 +1,100 @@
+package dqk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPgArrayValue(t *testing.T) {
+	value, err := PgArray{"go", `say "hi"`, `back\slash`}.Value()
+	assert.NoError(t, err)
+	assert.Equal(t, `{"go","say \"hi\"","back\\slash"}`, value)
+
+	value, err = PgArray(nil).Value()
+	assert.NoError(t, err)
+	assert.Nil(t, value)
+}
+
+func TestArrayConditions(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       Filters
+		values       []string
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "postgres contains",
+			filter:       Filters{Name: "tags", Operator: "@>", DbField: "posts.tags", Dialect: DialectPostgres},
+			values:       []string{"go", "sql", "go"},
+			expectedSQL:  "posts.tags @> ?",
+			expectedArgs: []any{PgArray{"go", "sql"}},
+		},
+		{
+			name:         "overlaps without dialect",
+			filter:       Filters{Name: "tags", Operator: "&&", DbField: "posts.tags"},
+			values:       []string{"go", "sql"},
+			expectedSQL:  "posts.tags && ?",
+			expectedArgs: []any{PgArray{"go", "sql"}},
+		},
+		{
+			name:         "postgres any",
+			filter:       Filters{Name: "status", Operator: "any", DbField: "posts.status", Dialect: DialectPostgres},
+			values:       []string{"draft", "published"},
+			expectedSQL:  "posts.status = ANY(?)",
+			expectedArgs: []any{PgArray{"draft", "published"}},
+		},
+		{
+			name:         "mysql contains",
+			filter:       Filters{Name: "tags", Operator: "@>", DbField: "posts.tags", Dialect: DialectMySQL},
+			values:       []string{"go", "sql"},
+			expectedSQL:  "JSON_CONTAINS(posts.tags, ?)",
+			expectedArgs: []any{`["go","sql"]`},
+		},
+		{
+			name:         "mysql overlaps",
+			filter:       Filters{Name: "tags", Operator: "&&", DbField: "posts.tags", Dialect: DialectMySQL},
+			values:       []string{"go", "sql"},
+			expectedSQL:  "JSON_OVERLAPS(posts.tags, ?)",
+			expectedArgs: []any{`["go","sql"]`},
+		},
+		{
+			name:         "mysql any",
+			filter:       Filters{Name: "status", Operator: "ANY", DbField: "posts.status", Dialect: DialectMySQL},
+			values:       []string{"draft", "published"},
+			expectedSQL:  "posts.status IN (?,?)",
+			expectedArgs: []any{"draft", "published"},
+		},
+		{
+			name:         "sqlite contains",
+			filter:       Filters{Name: "tags", Operator: "@>", DbField: "posts.tags", Dialect: DialectSQLite},
+			values:       []string{"go", "sql"},
+			expectedSQL:  "(SELECT COUNT(DISTINCT json_each.value) FROM json_each(posts.tags) WHERE json_each.value IN (?,?)) = ?",
+			expectedArgs: []any{"go", "sql", 2},
+		},
+		{
+			name:         "sqlite overlaps",
+			filter:       Filters{Name: "tags", Operator: "&&", DbField: "posts.tags", Dialect: DialectSQLite},
+			values:       []string{"go"},
+			expectedSQL:  "EXISTS (SELECT 1 FROM json_each(posts.tags) WHERE json_each.value IN (?))",
+			expectedArgs: []any{"go"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionals := BuildFilterConditions([]Filters{tt.filter}, map[string][]string{tt.filter.Name: tt.values})
+			assert.Len(t, conditionals, 1)
+			sql, args, err := conditionals[0].Expresion.ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestArrayParamsApplied(t *testing.T) {
+	filters := []Filters{{Name: "tags", Operator: "&&", DbField: "posts.tags"}}
+	applied := GetParamsApplied(filters, map[string][]string{"tags": {"go", "sql"}})
+	assert.Equal(t, map[string]string{"posts.tags &&": "go,sql"}, applied)
+}
@@ -0,0 +1,111 @@
+package dqk
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+)
+
+type contextKey string
+
+const permissionsKey contextKey = "dqk_permissions"
+
+// WithPermissions returns a copy of ctx carrying the permission set of the user, usually
+// built with BuildPermissionSet by an authentication middleware
+func WithPermissions(ctx context.Context, perms map[string]bool) context.Context {
+	return context.WithValue(ctx, permissionsKey, perms)
+}
+
+// PermissionsFromContext returns the permission set stored with WithPermissions
+func PermissionsFromContext(ctx context.Context) (map[string]bool, bool) {
+	perms, ok := ctx.Value(permissionsKey).(map[string]bool)
+	return perms, ok && perms != nil
+}
+
+// PermissionExtractor returns the permission set of the request and false when the user is not authenticated
+type PermissionExtractor func(r *http.Request) (map[string]bool, bool)
+
+// Authorizer provides authorization middlewares. Requests without permissions get 401 Unauthorized
+// and requests missing the required permissions get 403 Forbidden, both as an ErrorResponse
+// encoded with the Accept header of the request.
+type Authorizer struct {
+	// Extractor reads the permissions of the request, PermissionsFromContext on the request context by default
+	Extractor PermissionExtractor
+}
+
+// DefaultAuthorizer reads the permissions set with WithPermissions
+var DefaultAuthorizer = Authorizer{}
+
+// RequirePermission requires all the permissions, see RequireAll
+func (a Authorizer) RequirePermission(perms ...string) Middleware {
+	return a.RequireAll(perms...)
+}
+
+// RequireAll requires the user to have every one of the permissions
+func (a Authorizer) RequireAll(perms ...string) Middleware {
+	return a.require(func(userPerms map[string]bool) bool {
+		for _, perm := range perms {
+			if !HasPermission(perm, userPerms) {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+// RequireAny requires the user to have at least one of the permissions.
+// RequireAny(base, elevated) works like IsAccessRestricted
+func (a Authorizer) RequireAny(perms ...string) Middleware {
+	return a.require(func(userPerms map[string]bool) bool {
+		for _, perm := range perms {
+			if HasPermission(perm, userPerms) {
+				return true
+			}
+		}
+		return len(perms) == 0
+	})
+}
+
+func (a Authorizer) require(allowed func(map[string]bool) bool) Middleware {
+	extract := a.Extractor
+	if extract == nil {
+		extract = func(r *http.Request) (map[string]bool, bool) {
+			return PermissionsFromContext(r.Context())
+		}
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userPerms, ok := extract(r)
+			if !ok {
+				writeErrorResponse(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+				return
+			}
+			if !allowed(userPerms) {
+				slog.LogAttrs(r.Context(), slog.LevelDebug, "permission denied", slog.String("method", r.Method), slog.String("path", r.URL.Path))
+				writeErrorResponse(w, r, http.StatusForbidden, http.StatusText(http.StatusForbidden))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission requires all the permissions with the DefaultAuthorizer
+//
+// Example:
+//
+//	stack := CreateStack(Logging, authenticate, RequirePermission("view:users"))
+func RequirePermission(perms ...string) Middleware {
+	return DefaultAuthorizer.RequirePermission(perms...)
+}
+
+// RequireAll requires every one of the permissions with the DefaultAuthorizer
+func RequireAll(perms ...string) Middleware {
+	return DefaultAuthorizer.RequireAll(perms...)
+}
+
+// RequireAny requires at least one of the permissions with the DefaultAuthorizer
+func RequireAny(perms ...string) Middleware {
+	return DefaultAuthorizer.RequireAny(perms...)
+}
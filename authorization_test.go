@@ -0,0 +1,81 @@
+package dqk
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequirePermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		middleware Middleware
+		perms      map[string]bool
+		expected   int
+	}{
+		{name: "no permissions", middleware: RequirePermission("view:users"), perms: nil, expected: http.StatusUnauthorized},
+		{name: "missing permission", middleware: RequirePermission("view:users"), perms: BuildPermissionSet([]string{"view:posts"}), expected: http.StatusForbidden},
+		{name: "has permission", middleware: RequirePermission("view:users"), perms: BuildPermissionSet([]string{"view:users"}), expected: http.StatusOK},
+		{name: "all missing one", middleware: RequireAll("view:users", "edit:users"), perms: BuildPermissionSet([]string{"view:users"}), expected: http.StatusForbidden},
+		{name: "all", middleware: RequireAll("view:users", "edit:users"), perms: BuildPermissionSet([]string{"view:users", "edit:users"}), expected: http.StatusOK},
+		{name: "any", middleware: RequireAny("view:user", "viewAll:users"), perms: BuildPermissionSet([]string{"viewAll:users"}), expected: http.StatusOK},
+		{name: "any missing", middleware: RequireAny("view:user", "viewAll:users"), perms: map[string]bool{}, expected: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := tt.middleware(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.perms != nil {
+				req = req.WithContext(WithPermissions(req.Context(), tt.perms))
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusOK {
+				return
+			}
+			var response ErrorResponse
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			assert.Equal(t, tt.expected, response.Status)
+			assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+		})
+	}
+}
+
+func TestAuthorizerExtractor(t *testing.T) {
+	authorizer := Authorizer{Extractor: func(r *http.Request) (map[string]bool, bool) {
+		role := r.Header.Get("X-Role")
+		if role == "" {
+			return nil, false
+		}
+		return BuildPermissionSet([]string{role}), true
+	}}
+	handler := authorizer.RequirePermission("admin")(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Role", "admin")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("X-Role", "user")
+	req.Header.Set("Accept", "application/xml")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Equal(t, "application/xml", w.Header().Get("Content-Type"))
+	var response ErrorResponse
+	assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, http.StatusForbidden, response.Status)
+}
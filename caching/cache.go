@@ -33,6 +33,8 @@ func GetCache(cacheType string, c *CacheConfig) Cache {
 		cache = SetUpMemcachedDB(c)
 	case "redis":
 		cache = SetUpRedisDB(c)
+	case "memory":
+		cache = SetUpMemoryDB(c)
 	default:
 		panic("Unsupported cache type: " + cacheType)
 	}
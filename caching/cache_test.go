@@ -15,6 +15,7 @@ func TestGetCache(t *testing.T) {
 	}{
 		{"redis", false},
 		{"memcached", false},
+		{"memory", false},
 		{"unknown", true},
 	}
 
@@ -55,6 +56,12 @@ func TestSetKey(t *testing.T) {
 			prefix:      "test:" + testName,
 			key:         "hello",
 		},
+		{
+			cacheType:   "memory",
+			expectPanic: false,
+			prefix:      "test:" + testName,
+			key:         "hello",
+		},
 	}
 
 	for _, test := range tests {
@@ -91,6 +98,12 @@ func TestSetKeyIndexAndDeleteCacheIndex(t *testing.T) {
 			prefix:      "test:" + testName,
 			key:         "hello",
 		},
+		{
+			cacheType:   "memory",
+			expectPanic: false,
+			prefix:      "test:" + testName,
+			key:         "hello",
+		},
 	}
 
 	for _, test := range tests {
@@ -131,6 +144,12 @@ func TestGetKey(t *testing.T) {
 			prefix:      "test:" + testName,
 			key:         "hello",
 		},
+		{
+			cacheType:   "memory",
+			expectPanic: false,
+			prefix:      "test:" + testName,
+			key:         "hello",
+		},
 	}
 
 	for _, test := range tests {
@@ -171,6 +190,12 @@ func TestCacheIncrement(t *testing.T) {
 			prefix:      "test:" + testName,
 			key:         "ip:123",
 		},
+		{
+			cacheType:   "memory",
+			expectPanic: false,
+			prefix:      "test:" + testName,
+			key:         "ip:123",
+		},
 	}
 
 	for _, test := range tests {
@@ -207,6 +232,12 @@ func TestDefaultPrefix(t *testing.T) {
 			key:         "hello",
 			HashKeys:    true,
 		},
+		{
+			cacheType:   "memory",
+			expectPanic: false,
+			key:         "hello",
+			HashKeys:    true,
+		},
 	}
 
 	for _, test := range tests {
@@ -0,0 +1,238 @@
+package caching
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	//MemoryDB is an in process implementation of cache.
+	//it is meant for tests, development and single instance deployments
+	MemoryDB struct {
+		mu        sync.Mutex
+		items     map[string]memoryItem
+		indexes   map[string]map[string]bool
+		config    *CacheConfig
+		now       func() time.Time
+		nextSweep time.Time
+	}
+
+	memoryItem struct {
+		value   []byte
+		expires time.Time
+	}
+)
+
+// memorySweepInterval is the minimum time between two sweeps of the expired keys
+const memorySweepInterval = time.Minute
+
+// SetUpMemoryDB initializes the in memory cache. Expired keys are removed when they are read,
+// the rest are swept by writes at most once per minute along with the index members that no
+// longer exist, so the memory used is bounded by the keys that were live during the last minute.
+func SetUpMemoryDB(c *CacheConfig) *MemoryDB {
+	m := &MemoryDB{
+		items:   map[string]memoryItem{},
+		indexes: map[string]map[string]bool{},
+		config:  c,
+		now:     time.Now,
+	}
+	defaultOpts := getMemoryDefaultOpt()
+
+	if m.config.Enabled == nil {
+		m.config.Enabled = defaultOpts.Enabled
+	}
+	if m.config.HashKeys == nil {
+		m.config.HashKeys = defaultOpts.HashKeys
+	}
+	if m.config.Prefix == "" {
+		m.config.Prefix = defaultOpts.Prefix
+	}
+	if m.config.DefaultExpiration == nil {
+		m.config.DefaultExpiration = defaultOpts.DefaultExpiration
+	}
+	return m
+}
+
+// SetKey sets a key with a provided value and a ttl.
+func (m *MemoryDB) SetKey(key string, value string, ttl *time.Duration) error {
+	key = m.getCacheKey(key)
+	expiration := *m.config.DefaultExpiration
+	if ttl != nil {
+		expiration = *ttl
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	m.items[key] = memoryItem{value: []byte(value), expires: m.expiresAt(expiration)}
+	return nil
+}
+
+// SetKeyIndex adds the key to the index of a route
+func (m *MemoryDB) SetKeyIndex(indexKey string, member string) error {
+	indexKey = m.getCacheKey(indexKey + ":keys")
+	member = m.getCacheKey(member)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	if m.indexes[indexKey] == nil {
+		m.indexes[indexKey] = map[string]bool{}
+	}
+	m.indexes[indexKey][member] = true
+	return nil
+}
+
+// DeleteCacheIndex clears the cache indexes for a provided route
+func (m *MemoryDB) DeleteCacheIndex(indexKey string) (int, error) {
+	indexKey = m.getCacheKey(indexKey + ":keys")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members, ok := m.indexes[indexKey]
+	if !ok {
+		slog.LogAttrs(context.Background(), slog.LevelDebug, "no cache for provided key", slog.String("key", indexKey))
+		return 0, nil
+	}
+
+	evictedKeys := 0
+	for member := range members {
+		if _, ok := m.items[member]; ok {
+			delete(m.items, member)
+			evictedKeys++
+		}
+	}
+	delete(m.indexes, indexKey)
+	evictedKeys++
+	return evictedKeys, nil
+}
+
+// Get returns the value of a key, expired keys are reported as missing
+func (m *MemoryDB) Get(key string) ([]byte, error) {
+	key = m.getCacheKey(key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	item, ok := m.get(key)
+	if !ok {
+		return []byte{}, fmt.Errorf("cache miss for key %q", key)
+	}
+	return append([]byte{}, item.value...), nil
+}
+
+// Delete removes the keys and returns how many existed
+func (m *MemoryDB) Delete(keys ...string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	evictedKeys := 0
+	for _, key := range keys {
+		key = m.getCacheKey(key)
+		if _, ok := m.get(key); ok {
+			evictedKeys++
+		}
+		delete(m.items, key)
+	}
+	return evictedKeys, nil
+}
+
+// CacheIncrement increments a counter. The expiration is only set when the counter is created
+func (m *MemoryDB) CacheIncrement(key string, expiration time.Duration) error {
+	key = m.getCacheKey(key)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sweep()
+	item, ok := m.get(key)
+	if !ok {
+		m.items[key] = memoryItem{value: []byte("1"), expires: m.expiresAt(expiration)}
+		return nil
+	}
+
+	val, err := strconv.Atoi(string(item.value))
+	if err != nil {
+		return fmt.Errorf("failed to increment key %q: %w", key, err)
+	}
+	item.value = strconv.AppendInt(nil, int64(val+1), 10)
+	m.items[key] = item
+	return nil
+}
+
+// get returns a live item, the lock must be held
+func (m *MemoryDB) get(key string) (memoryItem, bool) {
+	item, ok := m.items[key]
+	if !ok {
+		return item, false
+	}
+	if !item.expires.IsZero() && !m.now().Before(item.expires) {
+		delete(m.items, key)
+		return item, false
+	}
+	return item, true
+}
+
+// sweep removes the expired items and the index members that no longer exist when
+// memorySweepInterval has passed since the last sweep, the lock must be held
+func (m *MemoryDB) sweep() {
+	now := m.now()
+	if now.Before(m.nextSweep) {
+		return
+	}
+	m.nextSweep = now.Add(memorySweepInterval)
+
+	for key, item := range m.items {
+		if !item.expires.IsZero() && !now.Before(item.expires) {
+			delete(m.items, key)
+		}
+	}
+	for indexKey, members := range m.indexes {
+		for member := range members {
+			if _, ok := m.items[member]; !ok {
+				delete(members, member)
+			}
+		}
+		if len(members) == 0 {
+			delete(m.indexes, indexKey)
+		}
+	}
+}
+
+// expiresAt returns the expiration time of a ttl, a ttl <= 0 never expires
+func (m *MemoryDB) expiresAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return m.now().Add(ttl)
+}
+
+func getMemoryDefaultOpt() CacheConfig {
+	midnight := time.Date(time.Now().Year(), time.Now().Month(), time.Now().Day()+1, 0, 0, 0, 0, time.Now().Location()).Sub(time.Now())
+	enabled := true
+	hashKeys := false
+	defaultOpt := CacheConfig{
+		Enabled:           &enabled,
+		Prefix:            "default",
+		HashKeys:          &hashKeys,
+		DefaultExpiration: &midnight,
+	}
+	return defaultOpt
+}
+
+func (m *MemoryDB) getCacheKey(key string) string {
+	Hashing := m.config.HashKeys
+	var shouldHash bool
+	if Hashing != nil {
+		shouldHash = *Hashing
+	}
+
+	key = fmt.Sprintf("%s:%s", m.config.Prefix, key)
+	if shouldHash {
+		key = hashKey(key)
+	}
+
+	return key
+}
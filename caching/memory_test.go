@@ -0,0 +1,64 @@
+package caching
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryDB(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	cache := SetUpMemoryDB(&CacheConfig{Prefix: "test:memory"})
+	cache.now = func() time.Time { return now }
+
+	ttl := time.Minute
+	assert.NoError(t, cache.SetKey("hello", "world", &ttl))
+	value, err := cache.Get("hello")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("world"), value)
+
+	assert.NoError(t, cache.CacheIncrement("counter", time.Minute))
+	assert.NoError(t, cache.CacheIncrement("counter", time.Hour))
+	value, err = cache.Get("counter")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("2"), value)
+
+	assert.NoError(t, cache.SetKeyIndex("/users", "hello"))
+	assert.NoError(t, cache.SetKeyIndex("/users", "missing"))
+	evicted, err := cache.DeleteCacheIndex("/users")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, evicted)
+	_, err = cache.Get("hello")
+	assert.Error(t, err)
+
+	now = now.Add(time.Minute)
+	_, err = cache.Get("counter")
+	assert.Error(t, err, "the counter keeps the expiration of its first increment")
+
+	assert.NoError(t, cache.SetKey("a", "1", nil))
+	evicted, err = cache.Delete("a", "b")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, evicted)
+}
+
+func TestMemoryDBSweep(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	cache := SetUpMemoryDB(&CacheConfig{Prefix: "test:memory"})
+	cache.now = func() time.Time { return now }
+
+	ttl := time.Second
+	assert.NoError(t, cache.SetKey("a", "1", &ttl))
+	assert.NoError(t, cache.SetKeyIndex("/a", "a"))
+	assert.NoError(t, cache.SetKeyIndex("/b", "missing"))
+
+	now = now.Add(2 * time.Second)
+	assert.NoError(t, cache.SetKey("b", "1", &ttl))
+	assert.Len(t, cache.items, 2, "writes sweep at most once per interval")
+	assert.Len(t, cache.indexes, 2)
+
+	now = now.Add(memorySweepInterval)
+	assert.NoError(t, cache.SetKey("c", "1", nil))
+	assert.Len(t, cache.items, 1)
+	assert.Empty(t, cache.indexes, "indexes without live members are removed")
+}
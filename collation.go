@@ -0,0 +1,74 @@
+package dqk
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// CollationCitext marks a case insensitive filter on a postgres citext column,
+	// the column already compares case insensitively so the values are compared as is
+	CollationCitext = "citext"
+	// CollationNoCase is the sqlite case insensitive collation, used by default for sqlite filters
+	CollationNoCase = "NOCASE"
+)
+
+// isCaseInsensitiveOperator returns true for the operators affected by Filters.CaseInsensitive
+func isCaseInsensitiveOperator(operator string) bool {
+	switch strings.ToUpper(strings.TrimSpace(operator)) {
+	case "=", "!=", "<>", "IN", "NOT IN":
+		return true
+	}
+	return false
+}
+
+// normalizeValue returns the NFC form of a value so composed and decomposed
+// characters (ie. "é" and "é") match the same rows
+func normalizeValue(value string) string {
+	return norm.NFC.String(value)
+}
+
+// caseInsensitiveCondition compares the filter column with the values case insensitively:
+//   - Collation set: column COLLATE <Collation> = ?, or a plain comparison for CollationCitext
+//   - sqlite: column COLLATE NOCASE = ?
+//   - otherwise: LOWER(column) = LOWER(?)
+//
+// IN & NOT IN lists are compared the same way.
+func caseInsensitiveCondition(filter Filters, values []string) sq.Sqlizer {
+	operator := strings.ToUpper(strings.TrimSpace(filter.Operator))
+	column, placeholder := filter.DbField, "?"
+
+	collation := filter.Collation
+	if collation == "" && filter.Dialect == DialectSQLite {
+		collation = CollationNoCase
+	}
+	switch {
+	case strings.EqualFold(collation, CollationCitext):
+	case collation != "":
+		column = fmt.Sprintf("%s COLLATE %s", column, collation)
+	default:
+		column, placeholder = fmt.Sprintf("LOWER(%s)", column), "LOWER(?)"
+	}
+
+	args := make([]any, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	if operator == "IN" || operator == "NOT IN" {
+		placeholders := strings.TrimSuffix(strings.Repeat(placeholder+",", len(values)), ",")
+		return sq.Expr(fmt.Sprintf("%s %s (%s)", column, operator, placeholders), args...)
+	}
+
+	conditions := sq.And{}
+	for _, arg := range args {
+		conditions = append(conditions, sq.Expr(fmt.Sprintf("%s %s %s", column, operator, placeholder), arg))
+	}
+	if len(conditions) == 1 {
+		return conditions[0]
+	}
+	return conditions
+}
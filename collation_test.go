@@ -0,0 +1,77 @@
+package dqk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCaseInsensitiveConditions(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       Filters
+		values       []string
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "lower equality",
+			filter:       Filters{Name: "email", Operator: "=", DbField: "users.email", CaseInsensitive: true},
+			values:       []string{"Foo@Bar.com"},
+			expectedSQL:  "LOWER(users.email) = LOWER(?)",
+			expectedArgs: []any{"Foo@Bar.com"},
+		},
+		{
+			name:         "lower IN",
+			filter:       Filters{Name: "email", Operator: "IN", DbField: "users.email", CaseInsensitive: true, Dialect: DialectPostgres},
+			values:       []string{"Foo@Bar.com", "baz@bar.com"},
+			expectedSQL:  "LOWER(users.email) IN (LOWER(?),LOWER(?))",
+			expectedArgs: []any{"Foo@Bar.com", "baz@bar.com"},
+		},
+		{
+			name:         "sqlite nocase",
+			filter:       Filters{Name: "email", Operator: "!=", DbField: "users.email", CaseInsensitive: true, Dialect: DialectSQLite},
+			values:       []string{"Foo@Bar.com"},
+			expectedSQL:  "users.email COLLATE NOCASE != ?",
+			expectedArgs: []any{"Foo@Bar.com"},
+		},
+		{
+			name:         "explicit collation",
+			filter:       Filters{Name: "email", Operator: "NOT IN", DbField: "users.email", CaseInsensitive: true, Collation: "utf8mb4_0900_ai_ci"},
+			values:       []string{"a", "b"},
+			expectedSQL:  "users.email COLLATE utf8mb4_0900_ai_ci NOT IN (?,?)",
+			expectedArgs: []any{"a", "b"},
+		},
+		{
+			name:         "citext",
+			filter:       Filters{Name: "email", Operator: "=", DbField: "users.email", CaseInsensitive: true, Collation: CollationCitext},
+			values:       []string{"Foo@Bar.com"},
+			expectedSQL:  "users.email = ?",
+			expectedArgs: []any{"Foo@Bar.com"},
+		},
+		{
+			name:         "unicode normalization",
+			filter:       Filters{Name: "name", Operator: "=", DbField: "users.name", CaseInsensitive: true},
+			values:       []string{"Re\u0301my"},
+			expectedSQL:  "LOWER(users.name) = LOWER(?)",
+			expectedArgs: []any{"R\u00e9my"},
+		},
+		{
+			name:         "other operators are not affected",
+			filter:       Filters{Name: "age", Operator: ">", DbField: "users.age", CaseInsensitive: true},
+			values:       []string{"18"},
+			expectedSQL:  "users.age > ?",
+			expectedArgs: []any{"18"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionals := BuildFilterConditions([]Filters{tt.filter}, map[string][]string{tt.filter.Name: tt.values})
+			assert.Len(t, conditionals, 1)
+			sql, args, err := conditionals[0].Expresion.ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package dqk
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CorsConfig configures NewCors
+type CorsConfig struct {
+	// AllowedOrigins are exact origins (https://app.example.com), wildcard subdomains (https://*.example.com)
+	// or "*" for any origin
+	AllowedOrigins []string `json:"allowed_origins" xml:"allowed_origins" yaml:"allowed_origins" csv:"allowed_origins"`
+	// AllowedOriginPatterns are matched against the whole origin
+	AllowedOriginPatterns []*regexp.Regexp `json:"-" xml:"-" yaml:"-" csv:"-"`
+	// AllowedMethods default to GET, POST, PUT, DELETE, OPTIONS
+	AllowedMethods []string `json:"allowed_methods" xml:"allowed_methods" yaml:"allowed_methods" csv:"allowed_methods"`
+	// AllowedHeaders default to Content-Type, Authorization. "*" allows the requested headers
+	AllowedHeaders []string `json:"allowed_headers" xml:"allowed_headers" yaml:"allowed_headers" csv:"allowed_headers"`
+	// ExposedHeaders can be read by the browser, ie. X-Total-Count
+	ExposedHeaders []string `json:"exposed_headers" xml:"exposed_headers" yaml:"exposed_headers" csv:"exposed_headers"`
+	// AllowCredentials allows cookies & Authorization headers for the origins matched by AllowedOrigins
+	// (other than "*") or AllowedOriginPatterns, which are reflected. Origins only allowed by "*" get
+	// "*" without credentials
+	AllowCredentials bool `json:"allow_credentials" xml:"allow_credentials" yaml:"allow_credentials" csv:"allow_credentials"`
+	// MaxAge is how long the preflight response can be cached
+	MaxAge time.Duration `json:"max_age" xml:"max_age" yaml:"max_age" csv:"max_age"`
+}
+
+// NewCors returns a CORS middleware for the config. Preflight requests (OPTIONS with
+// Access-Control-Request-Method) are answered with 204 No Content without calling the next handler,
+// or 403 Forbidden when the origin or the method is not allowed. Other requests from an origin that
+// is not allowed are served without CORS headers so the browser blocks the response.
+//
+// Example:
+//
+//	cors := NewCors(CorsConfig{
+//		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.com"},
+//		AllowCredentials: true,
+//		ExposedHeaders:   []string{"X-Total-Count"},
+//		MaxAge:           time.Hour,
+//	})
+//	stack := CreateStack(Logging, cors)
+func NewCors(config CorsConfig) Middleware {
+	methods := slices.Clone(config.AllowedMethods)
+	if len(methods) == 0 {
+		methods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+	}
+	for i := range methods {
+		methods[i] = strings.ToUpper(strings.TrimSpace(methods[i]))
+	}
+	headers := config.AllowedHeaders
+	if len(headers) == 0 {
+		headers = []string{"Content-Type", "Authorization"}
+	}
+	anyHeader := slices.Contains(headers, "*")
+	anyOrigin := slices.Contains(config.AllowedOrigins, "*")
+	// the response only depends on the origin when it can be reflected
+	reflected := !anyOrigin || config.AllowCredentials
+
+	allowedMethods := strings.Join(methods, ", ")
+	allowedHeaders := strings.Join(headers, ", ")
+	exposedHeaders := strings.Join(config.ExposedHeaders, ", ")
+	maxAge := strconv.Itoa(int(config.MaxAge.Seconds()))
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+			if reflected {
+				w.Header().Add("Vary", "Origin")
+			}
+			if preflight {
+				w.Header().Add("Vary", "Access-Control-Request-Method")
+				w.Header().Add("Vary", "Access-Control-Request-Headers")
+			}
+
+			if origin == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			matched := config.originAllowed(origin)
+			if !anyOrigin && !matched {
+				if preflight {
+					writeErrorResponse(w, r, http.StatusForbidden, "origin not allowed")
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// credentials are never allowed for origins only matched by "*"
+			if !anyOrigin || (config.AllowCredentials && matched) {
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+			} else {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			}
+			if config.AllowCredentials && matched {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposedHeaders != "" {
+					w.Header().Set("Access-Control-Expose-Headers", exposedHeaders)
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+			if !slices.Contains(methods, method) {
+				writeErrorResponse(w, r, http.StatusForbidden, "method not allowed")
+				return
+			}
+			w.Header().Set("Access-Control-Allow-Methods", allowedMethods)
+			if requested := r.Header.Get("Access-Control-Request-Headers"); anyHeader && requested != "" {
+				w.Header().Set("Access-Control-Allow-Headers", requested)
+			} else {
+				w.Header().Set("Access-Control-Allow-Headers", allowedHeaders)
+			}
+			if config.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", maxAge)
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
+
+// originAllowed matches the origin with the exact, wildcard subdomain & regex origins
+func (c CorsConfig) originAllowed(origin string) bool {
+	for _, allowed := range c.AllowedOrigins {
+		if strings.EqualFold(allowed, origin) {
+			return true
+		}
+		scheme, host, ok := strings.Cut(allowed, "*.")
+		if !ok {
+			continue
+		}
+		rest, found := strings.CutPrefix(strings.ToLower(origin), strings.ToLower(scheme))
+		if !found {
+			continue
+		}
+		subdomain, hasSuffix := strings.CutSuffix(rest, "."+strings.ToLower(host))
+		if hasSuffix && subdomain != "" && !strings.ContainsAny(subdomain, "/:@") {
+			return true
+		}
+	}
+	for _, pattern := range c.AllowedOriginPatterns {
+		if loc := pattern.FindStringIndex(origin); loc != nil && loc[0] == 0 && loc[1] == len(origin) {
+			return true
+		}
+	}
+	return false
+}
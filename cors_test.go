@@ -0,0 +1,185 @@
+package dqk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewCors(t *testing.T) {
+	config := CorsConfig{
+		AllowedOrigins:        []string{"https://app.example.com", "https://*.example.org"},
+		AllowedOriginPatterns: []*regexp.Regexp{regexp.MustCompile(`http://localhost:\d+`)},
+		AllowedMethods:        []string{"get", "post"},
+		ExposedHeaders:        []string{"X-Total-Count"},
+		AllowCredentials:      true,
+		MaxAge:                time.Hour,
+	}
+	handler := NewCors(config)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name            string
+		method          string
+		origin          string
+		requestMethod   string
+		expectedStatus  int
+		expectedOrigin  string
+		expectedHeaders map[string]string
+	}{
+		{
+			name:           "exact origin",
+			method:         http.MethodGet,
+			origin:         "https://app.example.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "https://app.example.com",
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Expose-Headers":    "X-Total-Count",
+				"Vary":                             "Origin",
+			},
+		},
+		{
+			name:           "wildcard subdomain",
+			method:         http.MethodGet,
+			origin:         "https://api.eu.example.org",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "https://api.eu.example.org",
+		},
+		{
+			name:           "wildcard does not match the apex domain",
+			method:         http.MethodGet,
+			origin:         "https://example.org",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "",
+		},
+		{
+			name:           "wildcard does not match another domain",
+			method:         http.MethodGet,
+			origin:         "https://evil-example.org",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "",
+		},
+		{
+			name:           "regex origin",
+			method:         http.MethodGet,
+			origin:         "http://localhost:3000",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "http://localhost:3000",
+		},
+		{
+			name:           "regex must match the whole origin",
+			method:         http.MethodGet,
+			origin:         "http://localhost:3000.evil.com",
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "",
+		},
+		{
+			name:           "preflight",
+			method:         http.MethodOptions,
+			origin:         "https://app.example.com",
+			requestMethod:  "POST",
+			expectedStatus: http.StatusNoContent,
+			expectedOrigin: "https://app.example.com",
+			expectedHeaders: map[string]string{
+				"Access-Control-Allow-Methods": "GET, POST",
+				"Access-Control-Allow-Headers": "Content-Type, Authorization",
+				"Access-Control-Max-Age":       "3600",
+			},
+		},
+		{
+			name:           "preflight method not allowed",
+			method:         http.MethodOptions,
+			origin:         "https://app.example.com",
+			requestMethod:  "DELETE",
+			expectedStatus: http.StatusForbidden,
+			expectedOrigin: "https://app.example.com",
+		},
+		{
+			name:           "preflight origin not allowed",
+			method:         http.MethodOptions,
+			origin:         "https://evil.com",
+			requestMethod:  "GET",
+			expectedStatus: http.StatusForbidden,
+			expectedOrigin: "",
+		},
+		{
+			name:           "no origin",
+			method:         http.MethodGet,
+			expectedStatus: http.StatusOK,
+			expectedOrigin: "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expectedStatus, w.Code)
+			assert.Equal(t, tt.expectedOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			for header, value := range tt.expectedHeaders {
+				assert.Equal(t, value, w.Header().Get(header), header)
+			}
+		})
+	}
+	assert.Equal(t, []string{"get", "post"}, config.AllowedMethods)
+}
+
+func TestNewCorsAnyOrigin(t *testing.T) {
+	handler := NewCors(CorsConfig{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req := httptest.NewRequest(http.MethodOptions, "/", nil)
+	req.Header.Set("Origin", "https://any.com")
+	req.Header.Set("Access-Control-Request-Method", "PUT")
+	req.Header.Set("Access-Control-Request-Headers", "X-Custom")
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "X-Custom", w.Header().Get("Access-Control-Allow-Headers"))
+	assert.NotContains(t, w.Header().Values("Vary"), "Origin")
+}
+
+func TestNewCorsAnyOriginCredentials(t *testing.T) {
+	handler := NewCors(CorsConfig{AllowedOrigins: []string{"*", "https://app.example.com"}, AllowCredentials: true})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name        string
+		origin      string
+		allowOrigin string
+		credentials string
+	}{
+		{name: "explicit origin", origin: "https://app.example.com", allowOrigin: "https://app.example.com", credentials: "true"},
+		{name: "any origin", origin: "https://evil.com", allowOrigin: "*", credentials: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Origin", tt.origin)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.Equal(t, tt.allowOrigin, w.Header().Get("Access-Control-Allow-Origin"))
+			assert.Equal(t, tt.credentials, w.Header().Get("Access-Control-Allow-Credentials"))
+			assert.Contains(t, w.Header().Values("Vary"), "Origin")
+		})
+	}
+}
@@ -9,6 +9,7 @@
 package dqk
 
 import (
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -17,12 +18,27 @@ import (
 )
 
 const (
-	TokenLimit   = "limit"
-	TokenOffset  = "offset"
-	TokenWhere   = "where"
-	TokenHaving  = "having"
-	tokenNull    = "__NULL__"
-	tokenNotNull = "__NOT_NULL__"
+	TokenLimit    = "limit"
+	TokenOffset   = "offset"
+	TokenWhere    = "where"
+	TokenHaving   = "having"
+	TokenQualify  = "qualify"
+	TokenBucket   = "bucket"
+	TokenTZ       = "tz"
+	TokenSort     = "sort"
+	TokenFields   = "fields"
+	tokenNull     = "__NULL__"
+	tokenNotNull  = "__NOT_NULL__"
+	qualifyColumn = "dqk_qualify"
+)
+
+const (
+	// KindTimestamp marks the filter whose DbField is used for time bucketing
+	KindTimestamp = "timestamp"
+	// KindNear filters by distance with a lat,lng,radius value
+	KindNear = "near"
+	// KindBBox filters by bounding box with a minLng,minLat,maxLng,maxLat value
+	KindBBox = "bbox"
 )
 
 // ErrorResponse standard for errors
@@ -46,39 +62,65 @@ type Filters struct {
 	Operator string `json:"operator" xml:"operator" yaml:"operator" csv:"operator"`
 	DbField  string `json:"db_field" xml:"db_field" yaml:"db_field" csv:"db_field"`
 	FieldID  string `json:"field_id" xml:"field_id" yaml:"field_id" csv:"field_id"`
+	// Kind gives the filter a special meaning on top of plain filtering. ie. KindTimestamp
+	Kind string `json:"kind" xml:"kind" yaml:"kind" csv:"kind"`
+	// Dialect is used by filters that need to emit database specific SQL
+	Dialect Dialect `json:"dialect" xml:"dialect" yaml:"dialect" csv:"dialect"`
+	// Clause forces the clause the filter is applied in (TokenWhere, TokenHaving or TokenQualify).
+	// When empty the clause is detected from the function calls in DbField
+	Clause string `json:"clause" xml:"clause" yaml:"clause" csv:"clause"`
+	// Expression replaces DbField with a computed expression that carries its own bind parameters
+	Expression *FilterExpression `json:"-" xml:"-" yaml:"-" csv:"-"`
+	// Geo are the latitude & longitude columns of KindNear & KindBBox filters when no spatial DbField is used
+	Geo *GeoColumns `json:"geo" xml:"geo" yaml:"geo" csv:"geo"`
+	// CaseInsensitive compares =, !=, IN & NOT IN filters case insensitively.
+	// Values are normalized to NFC before they are bound
+	CaseInsensitive bool `json:"case_insensitive" xml:"case_insensitive" yaml:"case_insensitive" csv:"case_insensitive"`
+	// Collation is used by CaseInsensitive filters instead of LOWER(). ie. utf8mb4_0900_ai_ci or CollationCitext
+	Collation string `json:"collation" xml:"collation" yaml:"collation" csv:"collation"`
+	// Default is the value used when the param is absent. It can be a null token, ie. __NULL__ for deleted_at IS NULL
+	Default string `json:"default" xml:"default" yaml:"default" csv:"default"`
+	// Required filters must be provided by the client (or have a Default), see ValidateRequiredFilters
+	Required bool `json:"required" xml:"required" yaml:"required" csv:"required"`
+	// Locked filters ignore the client values and are always applied with their Default
+	Locked bool `json:"locked" xml:"locked" yaml:"locked" csv:"locked"`
+	// Permission is required to use the filter, see PermittedFilters. Locked filters stay applied
+	// for users without it and can be overridden by users with it
+	Permission string `json:"permission" xml:"permission" yaml:"permission" csv:"permission"`
+	// restricted filters are only kept by PermittedFilters to apply their Default,
+	// they can not be selected or sorted on
+	restricted bool
 }
 
+// IsAggregate returns true if the filter belongs in a HAVING clause
 func (f *Filters) IsAggregate() bool {
-	var allowedAggregateFunctions = []string{
-		"count",
-		"sum",
-		"min",
-		"max",
-		"stddev",
-		"variance",
-	}
+	return f.FilterClause() == TokenHaving
+}
 
-	lower := strings.ToLower(f.DbField)
-	for _, agg := range allowedAggregateFunctions {
-		if strings.HasPrefix(lower, agg+"(") {
-			return true
-		}
+// FilterClause returns the clause the filter is applied in. An explicit Clause always wins,
+// otherwise window function calls go to QUALIFY, registered aggregate functions
+// (see RegisterAggregateFunctions) to HAVING and everything else to WHERE
+func (f *Filters) FilterClause() string {
+	switch clause := strings.ToLower(f.Clause); clause {
+	case TokenWhere, TokenHaving, TokenQualify:
+		return clause
 	}
-	return false
-
+	return expressionClause(f.columnSQL())
 }
 
+// HasNullOrNotNull returns true if any of the values is the NULL or NOT NULL token (see SetNullTokens)
 func (f *Filters) HasNullOrNotNull(values ...string) bool {
 	hasNullOrNot := false
 	for _, value := range values {
-		switch value {
-		case tokenNotNull, tokenNull:
+		if isNullToken(value) {
 			hasNullOrNot = true
 		}
 	}
 	return hasNullOrNot
 }
 
+// ApplyNullToken sets the operator of the filter to IS NULL or IS NOT NULL when a token is provided.
+// BuildFilterConditions no longer uses it since tokens can be mixed with values.
 func (f *Filters) ApplyNullToken(values ...string) bool {
 	applied := false
 	switch strings.ToLower(f.Name) {
@@ -86,12 +128,13 @@ func (f *Filters) ApplyNullToken(values ...string) bool {
 		return applied
 	}
 
+	null, notNull := GetNullTokens()
 	for _, value := range values {
 		switch value {
-		case tokenNull:
+		case null:
 			f.Operator = "IS NULL"
 			applied = true
-		case tokenNotNull:
+		case notNull:
 			f.Operator = "IS NOT NULL"
 			applied = true
 		}
@@ -155,6 +198,67 @@ func (c *Conditional) applyHaving(q sq.SelectBuilder) sq.SelectBuilder {
 	return q
 }
 
+// QualifyConfig describes the query QUALIFY conditions wrap. squirrel has no QUALIFY clause and does not
+// expose the columns or the ordering of a query, so they are passed explicitly
+type QualifyConfig struct {
+	// Columns are the names of the result columns of the query, ie. "id" for "cars.id" or "total" for
+	// "COUNT(*) AS total". The wrapping query only selects these, QUALIFY conditions fail without them
+	Columns []string
+	// OrderBy orders the result by filters. The order of a subquery is not kept, so the query must not be
+	// ordered itself when QUALIFY conditions wrap it
+	OrderBy []SearchSort
+	// Builder creates the wrapping query, give it the placeholder format & runner of the query
+	// (ie. sq.StatementBuilder.PlaceholderFormat(sq.Dollar)). sq.StatementBuilder is used when nil
+	Builder *sq.StatementBuilderType
+}
+
+// applyQualify wraps the query since squirrel has no QUALIFY clause.
+// The condition is selected as a column of the inner query and filtered by the outer one,
+// this keeps window functions evaluated after WHERE & HAVING like QUALIFY does.
+// The outer query selects config.Columns so the condition is not part of the result, the OrderBy
+// expressions are selected by the inner query so they can reference its tables.
+// Anything added to the query after the wrap is applied to the outer query and can only reference
+// the columns of "qualified".
+func (c *Conditional) applyQualify(q sq.SelectBuilder, config QualifyConfig, filters []Filters) (sq.SelectBuilder, error) {
+	if len(config.Columns) == 0 {
+		return q, fmt.Errorf("QUALIFY conditions need the result columns of the query, use DynamicFiltersQualify")
+	}
+	names := make([]string, 0, len(config.Columns))
+	for _, column := range config.Columns {
+		tokens := tokenizeSQL(column)
+		if len(tokens) != 1 || (tokens[0].kind != sqlIdent && tokens[0].kind != sqlQuotedIdent) {
+			return q, fmt.Errorf("result column %q is not a column name", column)
+		}
+		names = append(names, "qualified."+column)
+	}
+
+	inner := q.Column(sq.Alias(c.Expresion, qualifyColumn))
+	var orderBy []string
+	for i, sort := range config.OrderBy {
+		ok, filter := IsFieldFilter(filters, sort.Field)
+		if !ok {
+			return q, fmt.Errorf("can not order by %q, it is not a filter", sort.Field)
+		}
+		column, err := filter.ColumnExpr()
+		if err != nil {
+			return q, err
+		}
+		direction := strings.ToUpper(sort.Direction)
+		if direction != "DESC" {
+			direction = "ASC"
+		}
+		alias := fmt.Sprintf("%s_order_%d", qualifyColumn, i)
+		inner = inner.Column(sq.Alias(column, alias))
+		orderBy = append(orderBy, fmt.Sprintf("qualified.%s %s", alias, direction))
+	}
+
+	statement := sq.StatementBuilder
+	if config.Builder != nil {
+		statement = *config.Builder
+	}
+	return statement.Select(names...).FromSelect(inner, "qualified").Where(fmt.Sprintf("qualified.%s", qualifyColumn)).OrderBy(orderBy...), nil
+}
+
 func (c *Conditional) applyLimit(q sq.SelectBuilder) sq.SelectBuilder {
 	value, err := strconv.Atoi(c.Values[0])
 	if err != nil {
@@ -179,6 +283,10 @@ func (c *Conditional) Apply(q sq.SelectBuilder) sq.SelectBuilder {
 		q = c.applyWhere(q)
 	case TokenHaving:
 		q = c.applyHaving(q)
+	case TokenQualify:
+		// the result columns of the query are unknown here, the wrap fails
+		_, err := c.applyQualify(q, QualifyConfig{}, nil)
+		q = q.Where(invalidCondition{err: err})
 	case TokenLimit:
 		q = c.applyLimit(q)
 	case TokenOffset:
@@ -0,0 +1,12 @@
+package dqk
+
+// Dialect is the SQL dialect a filter is executed against.
+// Most filters produce portable SQL, but some features (time bucketing, geo, arrays)
+// need a different expression per database.
+type Dialect string
+
+const (
+	DialectPostgres Dialect = "postgres"
+	DialectMySQL    Dialect = "mysql"
+	DialectSQLite   Dialect = "sqlite"
+)
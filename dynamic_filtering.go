@@ -1,13 +1,16 @@
 package dqk
 
 import (
+	"context"
 	"fmt"
+	"log/slog"
+	"slices"
 	"strings"
 
 	sq "github.com/Masterminds/squirrel"
 )
 
-// AreFiltersAggregate returns true if any of the provided filters use an allowedAggregateFunctions
+// AreFiltersAggregate returns true if any of the provided filters belongs in a HAVING clause
 func AreFiltersAggregate(filters []Filters) bool {
 	aggregate := false
 	for _, filter := range filters {
@@ -32,11 +35,19 @@ func ValidateParams(filters []Filters, params map[string][]string) map[Filters][
 	conditionsSet := make(map[Filters][]string)
 
 	for _, filter := range filters {
-		values, ok := newMap[strings.ToLower(filter.Name)]
-		if len(values) == 0 || !ok {
-			continue
+		values := newMap[strings.ToLower(filter.Name)]
+		// empty values are absent, like in ValidateRequiredFilters
+		if slices.Contains(values, "") {
+			values = slices.DeleteFunc(slices.Clone(values), func(value string) bool {
+				return value == ""
+			})
+		}
+		if filter.Locked || len(values) == 0 {
+			if filter.Default == "" {
+				continue
+			}
+			values = []string{filter.Default}
 		}
-		filter.ApplyNullToken(values...)
 		conditionsSet[filter] = values
 	}
 
@@ -47,9 +58,13 @@ func ValidateParams(filters []Filters, params map[string][]string) map[Filters][
 func ValidateValus(filterValues map[Filters][]string) map[Filters][]string {
 	for filter, values := range filterValues {
 		for index, value := range values {
-			if value == "" {
+			if value == "" || isNullToken(value) {
 				continue
 			}
+			if filter.CaseInsensitive {
+				value = normalizeValue(value)
+				values[index] = value
+			}
 			switch filter.Operator {
 			case "LIKE", "ILIKE":
 				values[index] = fmt.Sprintf("%%%s%%", value)
@@ -70,24 +85,27 @@ func GetParamsApplied(filters []Filters, params map[string][]string) map[string]
 			continue
 		}
 
-		HasNullOrNotNull := filter.HasNullOrNotNull(allowedValues...)
-		if HasNullOrNotNull {
-			m[filter.DbField] = filter.Operator
+		if filter.Name == TokenLimit || filter.Name == TokenOffset {
+			m[fmt.Sprintf("%s", filter.Name)] = allowedValues[0]
 			continue
 		}
 
-		if filter.Operator == "IN" && !HasNullOrNotNull {
-			m[fmt.Sprintf("%s %s", filter.DbField, filter.Operator)] = strings.Join(allowedValues, ",")
-			continue
+		hasNull, hasNotNull, rest := splitNullTokens(allowedValues)
+		if hasNull || hasNotNull {
+			m[filter.columnSQL()] = strings.Join(nullOperators(hasNull, hasNotNull), ",")
+			if len(rest) == 0 {
+				continue
+			}
+			allowedValues = rest
 		}
 
-		if filter.Name == TokenLimit || filter.Name == TokenOffset {
-			m[fmt.Sprintf("%s", filter.Name)] = allowedValues[0]
+		if filter.Operator == "IN" || IsArrayOperator(filter.Operator) {
+			m[fmt.Sprintf("%s %s", filter.columnSQL(), filter.Operator)] = strings.Join(allowedValues, ",")
 			continue
 		}
 
 		for _, value := range allowedValues {
-			m[fmt.Sprintf("%s %s", filter.DbField, filter.Operator)] = value
+			m[fmt.Sprintf("%s %s", filter.columnSQL(), filter.Operator)] = value
 		}
 	}
 
@@ -97,7 +115,9 @@ func GetParamsApplied(filters []Filters, params map[string][]string) map[string]
 // BuildFilterConditions takes in allowed filters and values to be filtered. The key of the values map must match
 // the Filter.Name field. It returns first all where conditions (conditions that should be added in a where claus)
 // and having conditions (all conditions that should be added in a having claus) Both can be consolidated using
-// either sq.And() or sq.Or() or a custom method in order to be applied to a filter
+// either sq.And() or sq.Or() or a custom method in order to be applied to a filter.
+// The NULL & NOT NULL tokens (see SetNullTokens) can be mixed with values, ie. ?color=red&color=__NULL__
+// becomes (color IN (?) OR color IS NULL)
 func BuildFilterConditions(filters []Filters, params map[string][]string) []Conditional {
 	filterValues := ValidateParams(filters, params)
 	var conditionals []Conditional
@@ -106,60 +126,171 @@ func BuildFilterConditions(filters []Filters, params map[string][]string) []Cond
 		if len(values) <= 0 {
 			continue
 		}
-		HasNullOrNotNull := filter.HasNullOrNotNull(values...)
-		if HasNullOrNotNull {
+
+		if filter.Name == TokenLimit || filter.Name == TokenOffset {
 			conditionals = append(conditionals, NewConditional(
-				sq.Expr(fmt.Sprintf("%s %s", filter.DbField, filter.Operator)),
-				TokenWhere,
+				sq.Expr(fmt.Sprintf("%s ?", filter.Name), values[0]),
+				filter.Name,
 				values,
 			))
 			continue
 		}
 
-		if filter.Operator == "IN" && !HasNullOrNotNull {
-			conditionals = append(conditionals, NewConditional(
-				sq.Eq{filter.DbField: values},
-				TokenWhere,
-				values,
-			))
+		clause := filter.FilterClause()
+		if filter.Kind == KindNear || filter.Kind == KindBBox {
+			conditionals = append(conditionals, geoConditions(filter, clause, values)...)
 			continue
 		}
 
-		if filter.Name == TokenLimit || filter.Name == TokenOffset {
-			conditionals = append(conditionals, NewConditional(
-				sq.Expr(fmt.Sprintf("%s ?", filter.Name), values[0]),
-				filter.Name,
-				values,
-			))
-			continue
+		hasNull, hasNotNull, rest := splitNullTokens(values)
+		valueConditions := filterConditions(filter, rest)
+
+		var isNull sq.Sqlizer
+		if column, err := filter.ColumnExpr(); err == nil {
+			isNull, err = nullCondition(column, hasNull, hasNotNull)
+			if err != nil {
+				slog.LogAttrs(context.Background(), slog.LevelWarn, "invalid null filter", slog.String("filter", filter.Name), slog.String("error", err.Error()))
+			}
 		}
 
-		for _, value := range values {
-			if filter.IsAggregate() {
-				conditionals = append(conditionals, NewConditional(
-					sq.Expr(fmt.Sprintf("%s %s ?", filter.DbField, filter.Operator), value),
-					TokenHaving,
-					values,
-				))
-				continue
+		switch {
+		case isNull == nil:
+			for _, condition := range valueConditions {
+				conditionals = append(conditionals, NewConditional(condition, clause, values))
 			}
-			conditionals = append(conditionals, NewConditional(
-				sq.Expr(fmt.Sprintf("%s %s ?", filter.DbField, filter.Operator), value),
-				TokenWhere,
-				values,
-			))
+		case len(valueConditions) == 0:
+			conditionals = append(conditionals, NewConditional(isNull, clause, values))
+		case len(valueConditions) == 1:
+			conditionals = append(conditionals, NewConditional(sq.Or{valueConditions[0], isNull}, clause, values))
+		default:
+			conditionals = append(conditionals, NewConditional(sq.Or{sq.And(valueConditions), isNull}, clause, values))
 		}
 	}
 	return conditionals
 }
 
+// filterConditions returns the conditions comparing the filter with the values (without null tokens).
+// Operators that take a list (IN & array operators) produce a single condition, the rest one per value.
+func filterConditions(filter Filters, values []string) []sq.Sqlizer {
+	var conditions []sq.Sqlizer
+	if len(values) == 0 {
+		return conditions
+	}
+
+	if filter.Expression != nil {
+		return expressionConditions(filter, values)
+	}
+
+	if IsArrayOperator(filter.Operator) {
+		condition, err := arrayCondition(filter, values)
+		if err != nil {
+			slog.LogAttrs(context.Background(), slog.LevelWarn, "invalid array filter", slog.String("filter", filter.Name), slog.String("error", err.Error()))
+			return conditions
+		}
+		return append(conditions, condition)
+	}
+
+	if filter.CaseInsensitive && isCaseInsensitiveOperator(filter.Operator) {
+		return append(conditions, caseInsensitiveCondition(filter, values))
+	}
+
+	if filter.Operator == "IN" {
+		return append(conditions, sq.Eq{filter.DbField: values})
+	}
+
+	for _, value := range values {
+		conditions = append(conditions, comparison(filter, filter.DbField, nil, value))
+	}
+	return conditions
+}
+
+// ValidateRequiredFilters returns an error for the first Required filter that has no value in params
+// and no Default. Locked filters are never considered missing since clients can not provide them.
+func ValidateRequiredFilters(filters []Filters, params map[string][]string) error {
+	provided := map[string]bool{}
+	for k, v := range params {
+		for _, value := range v {
+			if value != "" {
+				provided[strings.ToLower(k)] = true
+			}
+		}
+	}
+
+	for _, filter := range filters {
+		if !filter.Required || filter.Locked || filter.Default != "" {
+			continue
+		}
+		if !provided[strings.ToLower(filter.Name)] {
+			return fmt.Errorf("missing required filter %q", filter.Name)
+		}
+	}
+	return nil
+}
+
+// invalidCondition fails the query when it is built, used when the filters can not be applied
+type invalidCondition struct {
+	err error
+}
+
+func (c invalidCondition) ToSql() (string, []any, error) {
+	return "", nil, c.err
+}
+
 // DynamicFilters it applies dynamic filters based on the allowed filters. These are added to the specified query
 // it can get the query params as is from the r.URL.query() method.
 // it does not stop the user from passing multiple = params
-// all conditions are passed as AND parameters. This is true for both having & where conditions
+// all conditions are passed as AND parameters. This is true for where, having & qualify conditions.
+// QUALIFY conditions need the result columns of the query, they fail the query on ToSql() here,
+// use DynamicFiltersQualify for filters that may use QUALIFY
+// Filters with a Default are applied when the param is absent and Locked filters always use their Default.
+// When a Required filter is missing the query fails on ToSql() with the error of ValidateRequiredFilters
 func DynamicFilters(f []Filters, q sq.SelectBuilder, queryParams map[string][]string) sq.SelectBuilder {
+	return DynamicFiltersQualify(f, q, queryParams, QualifyConfig{})
+}
+
+// DynamicFiltersQualify works like DynamicFilters, QUALIFY conditions wrap the query so they are applied
+// after the where & having conditions and before limit & offset (see QualifyConfig).
+// The result is ordered by config.OrderBy, with or without QUALIFY conditions.
+// When the wrap fails (ie. config.Columns is empty) the query fails on ToSql() with its error
+func DynamicFiltersQualify(f []Filters, q sq.SelectBuilder, queryParams map[string][]string, config QualifyConfig) sq.SelectBuilder {
+	if err := ValidateRequiredFilters(f, queryParams); err != nil {
+		slog.LogAttrs(context.Background(), slog.LevelDebug, "required filter missing", slog.String("method", "DynamicFilters"), slog.String("error", err.Error()))
+		return q.Where(invalidCondition{err: err})
+	}
+
 	conditions := BuildFilterConditions(f, queryParams)
+	var qualify sq.And
+	var pagination []Conditional
+
 	for _, condition := range conditions {
+		switch condition.Type {
+		case TokenQualify:
+			qualify = append(qualify, condition.Expresion)
+		case TokenLimit, TokenOffset:
+			pagination = append(pagination, condition)
+		default:
+			q = condition.Apply(q)
+		}
+	}
+
+	if len(qualify) > 0 {
+		condition := NewConditional(qualify, TokenQualify, nil)
+		wrapped, err := condition.applyQualify(q, config, f)
+		if err != nil {
+			slog.LogAttrs(context.Background(), slog.LevelDebug, "qualify conditions can not be applied", slog.String("method", "DynamicFiltersQualify"), slog.String("error", err.Error()))
+			return q.Where(invalidCondition{err: err})
+		}
+		q = wrapped
+	} else {
+		for _, sort := range config.OrderBy {
+			order, err := OrderExpression(sort.Field, sort.Direction, f)
+			if err != nil {
+				return q.Where(invalidCondition{err: err})
+			}
+			q = q.OrderByClause(order)
+		}
+	}
+	for _, condition := range pagination {
 		q = condition.Apply(q)
 	}
 
@@ -43,9 +43,27 @@ func TestIsAggregate(t *testing.T) {
 				{Name: "min lowercase", Operator: "=", DbField: "min(price)"},
 				{Name: "MAX uppercase", Operator: "=", DbField: "max(price)"},
 				{Name: "max lowercase", Operator: "=", DbField: "MAX(price)"},
+				{Name: "avg", Operator: ">", DbField: "AVG(price)"},
+				{Name: "whitespace before parenthesis", Operator: ">", DbField: "SUM (price)"},
+				{Name: "nested aggregate", Operator: ">", DbField: "COALESCE(SUM(price), 0)"},
+				{Name: "group_concat", Operator: "LIKE", DbField: "GROUP_CONCAT(tags.name)"},
+				{Name: "string_agg", Operator: "LIKE", DbField: "string_agg(tags.name, ',')"},
+				{Name: "bool_and", Operator: "=", DbField: "bool_and(active)"},
+				{Name: "percentile_cont", Operator: ">", DbField: "percentile_cont(0.5) WITHIN GROUP (ORDER BY price)"},
+				{Name: "explicit having", Operator: ">", DbField: "total_price", Clause: TokenHaving},
 			},
 			expected: true,
 		},
+		{
+			name: "not aggregates",
+			input: []Filters{
+				{Name: "aggregate in string literal", Operator: "=", DbField: "CONCAT('sum(', name)"},
+				{Name: "window function", Operator: "=", DbField: "SUM(price) OVER (PARTITION BY shop_id)"},
+				{Name: "qualified column", Operator: "=", DbField: "stats.avg"},
+				{Name: "explicit where", Operator: "=", DbField: "MAX(price)", Clause: TokenWhere},
+			},
+			expected: false,
+		},
 	}
 
 	for _, tt := range tests {
@@ -58,6 +76,26 @@ func TestIsAggregate(t *testing.T) {
 	}
 }
 
+func TestFilterClause(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   Filters
+		expected string
+	}{
+		{name: "plain column", filter: Filters{DbField: "cars.price"}, expected: TokenWhere},
+		{name: "aggregate", filter: Filters{DbField: "avg (cars.price)"}, expected: TokenHaving},
+		{name: "window function", filter: Filters{DbField: "ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price)"}, expected: TokenQualify},
+		{name: "aggregate window with filter", filter: Filters{DbField: "COUNT(*) FILTER (WHERE cars.sold) OVER w"}, expected: TokenQualify},
+		{name: "explicit clause", filter: Filters{DbField: "price_rank", Clause: "QUALIFY"}, expected: TokenQualify},
+		{name: "unknown explicit clause is ignored", filter: Filters{DbField: "cars.price", Clause: "order"}, expected: TokenWhere},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.FilterClause())
+		})
+	}
+}
+
 func TestAreFiltersAggregate(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -329,6 +367,36 @@ func TestBuildFilterConditions(t *testing.T) {
 			filters: []Filters{
 				{Name: "created_date", Operator: "=", DbField: "country.created_date", FieldID: "1"},
 				{Name: "deleted_date", Operator: "=", DbField: "country.deleted_date", FieldID: "1"},
+				{Name: "updated_date", Operator: "=", DbField: "country.updated_date", FieldID: "1"},
+			},
+			values: map[string][]string{
+				"created_date": {"__NOT_NULL__", "France", "Germany"},
+				"deleted_date": {"__NULL__", "France", "Germany"},
+				"updated_date": {"__NULL__"},
+			},
+			Conditionals: []Conditional{
+				NewConditional(
+					sq.Or{sq.And{sq.Expr("country.created_date = ?", "France"), sq.Expr("country.created_date = ?", "Germany")}, sq.Expr("country.created_date IS NOT NULL")},
+					TokenWhere,
+					[]string{"__NOT_NULL__", "France", "Germany"},
+				),
+				NewConditional(
+					sq.Or{sq.And{sq.Expr("country.deleted_date = ?", "France"), sq.Expr("country.deleted_date = ?", "Germany")}, sq.Expr("country.deleted_date IS NULL")},
+					TokenWhere,
+					[]string{"__NULL__", "France", "Germany"},
+				),
+				NewConditional(
+					sq.Expr("country.updated_date IS NULL"),
+					TokenWhere,
+					[]string{"__NULL__"},
+				),
+			},
+		},
+		{
+			name: "NULL & NOT NULL with IN",
+			filters: []Filters{
+				{Name: "created_date", Operator: "IN", DbField: "country.created_date", FieldID: "1"},
+				{Name: "deleted_date", Operator: "IN", DbField: "country.deleted_date", FieldID: "1"},
 			},
 			values: map[string][]string{
 				"created_date": {"__NOT_NULL__", "France", "Germany"},
@@ -336,12 +404,12 @@ func TestBuildFilterConditions(t *testing.T) {
 			},
 			Conditionals: []Conditional{
 				NewConditional(
-					sq.Expr("country.created_date IS NOT NULL"),
+					sq.Or{sq.Eq{"country.created_date": []string{"France", "Germany"}}, sq.Expr("country.created_date IS NOT NULL")},
 					TokenWhere,
 					[]string{"__NOT_NULL__", "France", "Germany"},
 				),
 				NewConditional(
-					sq.Expr("country.deleted_date IS NULL"),
+					sq.Or{sq.Eq{"country.deleted_date": []string{"France", "Germany"}}, sq.Expr("country.deleted_date IS NULL")},
 					TokenWhere,
 					[]string{"__NULL__", "France", "Germany"},
 				),
@@ -494,6 +562,131 @@ func TestDynamicFilters(t *testing.T) {
 
 }
 
+func TestDynamicFiltersQualify(t *testing.T) {
+	filters := []Filters{
+		{Name: "brand", Operator: "=", DbField: "cars.brand"},
+		{Name: "rank", Operator: "<=", DbField: "ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price)"},
+	}
+	params := map[string][]string{
+		"brand": {"tesla"},
+		"rank":  {"3"},
+		"limit": {"10"},
+	}
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	q := psql.Select("cars.id").From("cars")
+	query := DynamicFiltersQualify(filters, q, params, QualifyConfig{Columns: []string{"id"}, Builder: &psql})
+
+	sql, args, err := query.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT qualified.id FROM (SELECT cars.id, ((ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price) <= $1)) AS dqk_qualify FROM cars WHERE cars.brand = $2) AS qualified WHERE qualified.dqk_qualify LIMIT 10", sql)
+	assert.Equal(t, []any{"3", "tesla"}, args)
+
+	q = psql.Select("cars.id", "COUNT(*) OVER () AS total").From("cars")
+	config := QualifyConfig{Columns: []string{"id", "total"}, OrderBy: []SearchSort{{Field: "brand", Direction: "desc"}, {Field: "rank"}}, Builder: &psql}
+	sql, args, err = DynamicFiltersQualify(filters, q, params, config).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT qualified.id, qualified.total FROM (SELECT cars.id, COUNT(*) OVER () AS total, ((ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price) <= $1)) AS dqk_qualify, (cars.brand) AS dqk_qualify_order_0, (ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price)) AS dqk_qualify_order_1 FROM cars WHERE cars.brand = $2) AS qualified WHERE qualified.dqk_qualify ORDER BY qualified.dqk_qualify_order_0 DESC, qualified.dqk_qualify_order_1 ASC LIMIT 10", sql)
+	assert.Equal(t, []any{"3", "tesla"}, args)
+
+	q = psql.Select("cars.id").From("cars")
+	sql, _, err = DynamicFiltersQualify(filters, q, map[string][]string{"brand": {"tesla"}}, config).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT cars.id FROM cars WHERE cars.brand = $1 ORDER BY cars.brand DESC, ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price) ASC", sql, "the query is ordered without qualify conditions")
+
+	q = psql.Select("*").From("cars")
+	_, _, err = DynamicFilters(filters, q, params).ToSql()
+	assert.Error(t, err, "the result columns are needed to wrap the query")
+
+	_, _, err = DynamicFiltersQualify(filters, q, params, QualifyConfig{Columns: []string{"cars.id"}}).ToSql()
+	assert.Error(t, err, "result columns must be names")
+
+	_, _, err = DynamicFiltersQualify(filters, q, params, QualifyConfig{Columns: []string{"id"}, OrderBy: []SearchSort{{Field: "missing"}}}).ToSql()
+	assert.Error(t, err)
+}
+
+func TestDynamicFiltersDefaults(t *testing.T) {
+	tests := []struct {
+		name         string
+		filters      []Filters
+		params       map[string][]string
+		expectedSQL  string
+		expectedArgs []any
+		expectedErr  string
+	}{
+		{
+			name:         "default when absent",
+			filters:      []Filters{{Name: "status", Operator: "=", DbField: "posts.status", Default: "published"}},
+			params:       map[string][]string{},
+			expectedSQL:  "SELECT posts.id FROM posts WHERE posts.status = $1",
+			expectedArgs: []any{"published"},
+		},
+		{
+			name:         "default when empty",
+			filters:      []Filters{{Name: "status", Operator: "=", DbField: "posts.status", Default: "published"}},
+			params:       map[string][]string{"status": {""}},
+			expectedSQL:  "SELECT posts.id FROM posts WHERE posts.status = $1",
+			expectedArgs: []any{"published"},
+		},
+		{
+			name:         "empty values are ignored",
+			filters:      []Filters{{Name: "status", Operator: "IN", DbField: "posts.status"}},
+			params:       map[string][]string{"status": {"", "draft"}},
+			expectedSQL:  "SELECT posts.id FROM posts WHERE posts.status IN ($1)",
+			expectedArgs: []any{"draft"},
+		},
+		{
+			name:         "default overridden",
+			filters:      []Filters{{Name: "status", Operator: "=", DbField: "posts.status", Default: "published"}},
+			params:       map[string][]string{"status": {"draft"}},
+			expectedSQL:  "SELECT posts.id FROM posts WHERE posts.status = $1",
+			expectedArgs: []any{"draft"},
+		},
+		{
+			name:         "locked null default",
+			filters:      []Filters{{Name: "deleted_at", Operator: "=", DbField: "posts.deleted_at", Default: "__NULL__", Locked: true}},
+			params:       map[string][]string{"deleted_at": {"__NOT_NULL__"}},
+			expectedSQL:  "SELECT posts.id FROM posts WHERE posts.deleted_at IS NULL",
+			expectedArgs: nil,
+		},
+		{
+			name:         "locked without default",
+			filters:      []Filters{{Name: "owner", Operator: "=", DbField: "posts.owner", Locked: true}},
+			params:       map[string][]string{"owner": {"someone"}},
+			expectedSQL:  "SELECT posts.id FROM posts",
+			expectedArgs: nil,
+		},
+		{
+			name:         "required provided",
+			filters:      []Filters{{Name: "tenant", Operator: "=", DbField: "posts.tenant", Required: true}},
+			params:       map[string][]string{"Tenant": {"1"}},
+			expectedSQL:  "SELECT posts.id FROM posts WHERE posts.tenant = $1",
+			expectedArgs: []any{"1"},
+		},
+		{
+			name:        "required missing",
+			filters:     []Filters{{Name: "tenant", Operator: "=", DbField: "posts.tenant", Required: true}},
+			params:      map[string][]string{"tenant": {""}},
+			expectedErr: `missing required filter "tenant"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := sq.Select("posts.id").From("posts").PlaceholderFormat(sq.Dollar)
+			sql, args, err := DynamicFilters(tt.filters, q, tt.params).ToSql()
+			if tt.expectedErr != "" {
+				assert.EqualError(t, err, tt.expectedErr)
+				assert.EqualError(t, ValidateRequiredFilters(tt.filters, tt.params), tt.expectedErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, ValidateRequiredFilters(tt.filters, tt.params))
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
 func TestExtendFilters(t *testing.T) {
 	tests := []struct {
 		name     string
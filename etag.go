@@ -0,0 +1,152 @@
+package dqk
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// ComputeETag returns the ETag of the data, a quoted SHA-256 prefix. Weak ETags are prefixed with W/
+// and should be used when equivalent responses may differ in bytes, ie. with different encodings.
+func ComputeETag(data []byte, weak bool) string {
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	if weak {
+		return "W/" + etag
+	}
+	return etag
+}
+
+// DataEncodeETag encodes the data with DataEncode and returns the ETag of the encoded bytes
+//
+// Example:
+//
+//	data, contentType, etag, err := DataEncodeETag(AcceptedEncoding(r.Header.Get("Accept")), response, false)
+//	if NotModified(w, r, etag, updatedAt) {
+//		return
+//	}
+func DataEncodeETag(accept string, data any, weak bool) ([]byte, string, string, error) {
+	encoded, contentType, err := DataEncode(accept, data)
+	if err != nil {
+		return nil, contentType, "", err
+	}
+	return encoded, contentType, ComputeETag(encoded, weak), nil
+}
+
+// ETagMatches reports whether an If-None-Match header matches the ETag. The weak comparison
+// is used, as required for If-None-Match, so W/"x" matches "x".
+func ETagMatches(ifNoneMatch, etag string) bool {
+	if etag == "" {
+		return false
+	}
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// NotModified sets the ETag & Last-Modified headers (when provided) and writes 304 Not Modified
+// when the conditional headers of a GET or HEAD request match. It returns true when the response
+// was written. If-None-Match takes precedence over If-Modified-Since.
+func NotModified(w http.ResponseWriter, r *http.Request, etag string, lastModified time.Time) bool {
+	if etag != "" {
+		w.Header().Set("ETag", etag)
+	}
+	if !lastModified.IsZero() {
+		w.Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ifNoneMatch != "" {
+		if !ETagMatches(ifNoneMatch, etag) {
+			return false
+		}
+	} else {
+		since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+		if err != nil || lastModified.IsZero() || lastModified.Truncate(time.Second).After(since) {
+			return false
+		}
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// ETagConfig configures NewETag
+type ETagConfig struct {
+	// Weak ETags are computed, see ComputeETag
+	Weak bool `json:"weak" xml:"weak" yaml:"weak" csv:"weak"`
+}
+
+// etagRecorder buffers the response so its ETag can be computed before it is sent
+type etagRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rec *etagRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+}
+
+func (rec *etagRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.body.Write(b)
+}
+
+// ETag computes strong ETags for GET & HEAD responses, see NewETag
+func ETag(next http.Handler) http.Handler {
+	return defaultETag(next)
+}
+
+var defaultETag = NewETag(ETagConfig{})
+
+// NewETag returns a middleware that buffers 200 responses of GET & HEAD requests, sets their ETag
+// (unless the handler already set one) and answers matching If-None-Match requests with 304.
+// Handlers can set Last-Modified to also support If-Modified-Since.
+// Add it after CacheResponses so the cached entries keep the ETag of the response.
+func NewETag(config ETagConfig) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &etagRecorder{ResponseWriter: w}
+			next.ServeHTTP(rec, r)
+			if rec.status == 0 {
+				rec.status = http.StatusOK
+			}
+
+			if rec.status == http.StatusOK {
+				etag := w.Header().Get("ETag")
+				if etag == "" && r.Method == http.MethodGet {
+					etag = ComputeETag(rec.body.Bytes(), config.Weak)
+				}
+				lastModified, _ := http.ParseTime(w.Header().Get("Last-Modified"))
+				if NotModified(w, r, etag, lastModified) {
+					return
+				}
+			}
+			w.WriteHeader(rec.status)
+			w.Write(rec.body.Bytes())
+		})
+	}
+}
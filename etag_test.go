@@ -0,0 +1,213 @@
+package dqk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SteliosGiannatos/DynamicQueryKit/caching"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeETag(t *testing.T) {
+	strong := ComputeETag([]byte("hello"), false)
+	assert.Regexp(t, `^"[0-9a-f]{32}"$`, strong)
+	assert.Equal(t, strong, ComputeETag([]byte("hello"), false))
+	assert.NotEqual(t, strong, ComputeETag([]byte("hello!"), false))
+	assert.Equal(t, "W/"+strong, ComputeETag([]byte("hello"), true))
+}
+
+func TestETagMatches(t *testing.T) {
+	tests := []struct {
+		name        string
+		ifNoneMatch string
+		etag        string
+		expected    bool
+	}{
+		{name: "exact", ifNoneMatch: `"a"`, etag: `"a"`, expected: true},
+		{name: "weak header", ifNoneMatch: `W/"a"`, etag: `"a"`, expected: true},
+		{name: "weak etag", ifNoneMatch: `"a"`, etag: `W/"a"`, expected: true},
+		{name: "list", ifNoneMatch: `"b", "a"`, etag: `"a"`, expected: true},
+		{name: "any", ifNoneMatch: `*`, etag: `"a"`, expected: true},
+		{name: "different", ifNoneMatch: `"b"`, etag: `"a"`, expected: false},
+		{name: "no etag", ifNoneMatch: `*`, etag: "", expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, ETagMatches(tt.ifNoneMatch, tt.etag))
+		})
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name         string
+		method       string
+		headers      map[string]string
+		lastModified time.Time
+		expected     bool
+	}{
+		{name: "no conditional headers", method: http.MethodGet, lastModified: modified, expected: false},
+		{name: "etag match", method: http.MethodGet, headers: map[string]string{"If-None-Match": `"a"`}, expected: true},
+		{name: "etag mismatch", method: http.MethodGet, headers: map[string]string{"If-None-Match": `"b"`}, expected: false},
+		{name: "head", method: http.MethodHead, headers: map[string]string{"If-None-Match": `"a"`}, expected: true},
+		{name: "post", method: http.MethodPost, headers: map[string]string{"If-None-Match": `"a"`}, expected: false},
+		{
+			name:         "not modified since",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)},
+			lastModified: modified.Add(500 * time.Millisecond),
+			expected:     true,
+		},
+		{
+			name:         "modified since",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-Modified-Since": modified.Add(-time.Hour).Format(http.TimeFormat)},
+			lastModified: modified,
+			expected:     false,
+		},
+		{
+			name:         "if-none-match takes precedence",
+			method:       http.MethodGet,
+			headers:      map[string]string{"If-None-Match": `"b"`, "If-Modified-Since": modified.Format(http.TimeFormat)},
+			lastModified: modified,
+			expected:     false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/cars", nil)
+			for k, v := range tt.headers {
+				req.Header.Set(k, v)
+			}
+			rec := httptest.NewRecorder()
+			assert.Equal(t, tt.expected, NotModified(rec, req, `"a"`, tt.lastModified))
+			assert.Equal(t, `"a"`, rec.Header().Get("ETag"))
+			if tt.expected {
+				assert.Equal(t, http.StatusNotModified, rec.Code)
+			}
+			if !tt.lastModified.IsZero() {
+				assert.Equal(t, tt.lastModified.Format(http.TimeFormat), rec.Header().Get("Last-Modified"))
+			}
+		})
+	}
+}
+
+func TestETag(t *testing.T) {
+	modified := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	tests := []struct {
+		name       string
+		config     ETagConfig
+		handler    http.HandlerFunc
+		conditions map[string]string
+		expected   string
+	}{
+		{
+			name:   "strong",
+			config: ETagConfig{},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("cars"))
+			},
+			expected: ComputeETag([]byte("cars"), false),
+		},
+		{
+			name:   "weak",
+			config: ETagConfig{Weak: true},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("cars"))
+			},
+			expected: ComputeETag([]byte("cars"), true),
+		},
+		{
+			name:   "handler etag",
+			config: ETagConfig{},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("ETag", `"v1"`)
+				w.Write([]byte("cars"))
+			},
+			expected: `"v1"`,
+		},
+		{
+			name:   "last modified",
+			config: ETagConfig{},
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Last-Modified", modified.Format(http.TimeFormat))
+				w.Write([]byte("cars"))
+			},
+			conditions: map[string]string{"If-Modified-Since": modified.Format(http.TimeFormat)},
+			expected:   ComputeETag([]byte("cars"), false),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := NewETag(tt.config)(tt.handler)
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cars", nil))
+			assert.Equal(t, http.StatusOK, rec.Code)
+			assert.Equal(t, "cars", rec.Body.String())
+			assert.Equal(t, tt.expected, rec.Header().Get("ETag"))
+
+			conditions := tt.conditions
+			if conditions == nil {
+				conditions = map[string]string{"If-None-Match": rec.Header().Get("ETag")}
+			}
+			req := httptest.NewRequest(http.MethodGet, "/cars", nil)
+			for k, v := range conditions {
+				req.Header.Set(k, v)
+			}
+			rec = httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			assert.Equal(t, http.StatusNotModified, rec.Code)
+			assert.Empty(t, rec.Body.String())
+			assert.Equal(t, tt.expected, rec.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestETagSkipsErrors(t *testing.T) {
+	handler := ETag(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("missing"))
+	}))
+	req := httptest.NewRequest(http.MethodGet, "/cars", nil)
+	req.Header.Set("If-None-Match", "*")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, "missing", rec.Body.String())
+	assert.Empty(t, rec.Header().Get("ETag"))
+}
+
+func TestCacheResponsesETag(t *testing.T) {
+	cache := caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})
+	calls := 0
+	handler := CacheResponses(cache, CacheRoute{Route: "cars"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"status":200}`))
+	}))
+	etag := ComputeETag([]byte(`{"status":200}`), false)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cars", nil))
+	assert.Equal(t, "MISS", rec.Header().Get("X-Cache"))
+
+	req := httptest.NewRequest(http.MethodGet, "/cars", nil)
+	req.Header.Set("If-None-Match", etag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusNotModified, rec.Code)
+	assert.Equal(t, "HIT", rec.Header().Get("X-Cache"))
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+	assert.Empty(t, rec.Body.String())
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/cars", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, etag, rec.Header().Get("ETag"))
+	assert.Equal(t, `{"status":200}`, rec.Body.String())
+	assert.Equal(t, 1, calls)
+}
@@ -0,0 +1,130 @@
+package dqk
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// FilterExpression is a computed expression used by a filter instead of its DbField.
+// The template can carry its own bind parameters, and it is never formatted with user input.
+//
+// When every placeholder of the template is bound by the template itself the expression is used
+// like a DbField, ie. `LOWER(name)` or `similarity(name, ?)` with its argument, and compared with
+// the filter Operator: `LOWER(name) = ?`.
+//
+// When the template has more placeholders than arguments it is a complete predicate and the
+// remaining placeholders receive the user values, ie. `distance(lat, lng, ?, ?) < 5000` is
+// bound with ?near=37.98,23.72. Each value is split on commas and must provide exactly one value
+// per open placeholder, otherwise it is ignored. The Operator is not used in that case.
+type FilterExpression struct {
+	Template sq.Sqlizer
+}
+
+// NewFilterExpression returns a FilterExpression from a raw SQL template and its own arguments
+func NewFilterExpression(sql string, args ...any) *FilterExpression {
+	return &FilterExpression{Template: sq.Expr(sql, args...)}
+}
+
+// toSql returns the template and the number of placeholders left for user values
+func (e *FilterExpression) toSql() (string, []any, int, error) {
+	if e == nil || e.Template == nil {
+		return "", nil, 0, fmt.Errorf("filter expression has no template")
+	}
+	sql, args, err := e.Template.ToSql()
+	if err != nil {
+		return "", nil, 0, err
+	}
+
+	placeholders := 0
+	for _, token := range tokenizeSQL(sql) {
+		if token.kind == sqlPlaceholder {
+			placeholders++
+		}
+	}
+	open := placeholders - len(args)
+	if open < 0 {
+		return "", nil, 0, fmt.Errorf("filter expression %q has more arguments than placeholders", sql)
+	}
+	return sql, args, open, nil
+}
+
+// IsPredicate returns true when the template expects user values
+func (e *FilterExpression) IsPredicate() bool {
+	_, _, open, err := e.toSql()
+	return err == nil && open > 0
+}
+
+// ColumnExpr returns the filter column as an sq.Sqlizer, either the DbField or the Expression template.
+// It can be used for ordering or selecting an expression with its bind parameters.
+// Predicate expressions can not be used as a column.
+func (f *Filters) ColumnExpr() (sq.Sqlizer, error) {
+	if f.Expression == nil {
+		return sq.Expr(f.DbField), nil
+	}
+	sql, args, open, err := f.Expression.toSql()
+	if err != nil {
+		return nil, err
+	}
+	if open > 0 {
+		return nil, fmt.Errorf("filter %q is a predicate expression and can not be used as a column", f.Name)
+	}
+	return sq.Expr(sql, args...), nil
+}
+
+// columnSQL returns the SQL of the filter column without its arguments
+func (f *Filters) columnSQL() string {
+	if f.Expression == nil {
+		return f.DbField
+	}
+	sql, _, _, err := f.Expression.toSql()
+	if err != nil {
+		return f.DbField
+	}
+	return sql
+}
+
+// expressionConditions builds the conditions of a filter with an Expression
+func expressionConditions(filter Filters, values []string) []sq.Sqlizer {
+	method := "expressionConditions"
+	var conditions []sq.Sqlizer
+
+	sql, args, open, err := filter.Expression.toSql()
+	if err != nil {
+		slog.LogAttrs(context.Background(), slog.LevelWarn, "invalid filter expression", slog.String("method", method), slog.String("filter", filter.Name), slog.String("error", err.Error()))
+		return conditions
+	}
+
+	if open > 0 {
+		for _, value := range values {
+			parts := strings.Split(value, ",")
+			if len(parts) != open {
+				slog.LogAttrs(context.Background(), slog.LevelDebug, "ignoring value with wrong number of parts", slog.String("method", method), slog.String("filter", filter.Name), slog.Int("expected", open), slog.Int("got", len(parts)))
+				continue
+			}
+			bound := append([]any{}, args...)
+			for _, part := range parts {
+				bound = append(bound, strings.TrimSpace(part))
+			}
+			conditions = append(conditions, sq.Expr(sql, bound...))
+		}
+		return conditions
+	}
+
+	if filter.Operator == "IN" {
+		bound := append([]any{}, args...)
+		for _, value := range values {
+			bound = append(bound, value)
+		}
+		placeholders := strings.TrimSuffix(strings.Repeat("?,", len(values)), ",")
+		return append(conditions, sq.Expr(fmt.Sprintf("%s IN (%s)", sql, placeholders), bound...))
+	}
+
+	for _, value := range values {
+		conditions = append(conditions, comparison(filter, sql, args, value))
+	}
+	return conditions
+}
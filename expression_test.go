@@ -0,0 +1,122 @@
+package dqk
+
+import (
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpressionConditions(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       Filters
+		values       map[string][]string
+		expectedSQL  []string
+		expectedArgs [][]any
+		expectedType string
+	}{
+		{
+			name:         "column expression",
+			filter:       Filters{Name: "name", Operator: "=", Expression: NewFilterExpression("LOWER(cars.name)")},
+			values:       map[string][]string{"name": {"tesla"}},
+			expectedSQL:  []string{"LOWER(cars.name) = ?"},
+			expectedArgs: [][]any{{"tesla"}},
+			expectedType: TokenWhere,
+		},
+		{
+			name:         "column expression with its own arguments",
+			filter:       Filters{Name: "similar", Operator: ">", Expression: NewFilterExpression("similarity(cars.name, ?)", "model s")},
+			values:       map[string][]string{"similar": {"0.4"}},
+			expectedSQL:  []string{"similarity(cars.name, ?) > ?"},
+			expectedArgs: [][]any{{"model s", "0.4"}},
+			expectedType: TokenWhere,
+		},
+		{
+			name:         "IN expression",
+			filter:       Filters{Name: "brand", Operator: "IN", Expression: NewFilterExpression("COALESCE(cars.brand, cars.maker)")},
+			values:       map[string][]string{"brand": {"tesla", "bmw"}},
+			expectedSQL:  []string{"COALESCE(cars.brand, cars.maker) IN (?,?)"},
+			expectedArgs: [][]any{{"tesla", "bmw"}},
+			expectedType: TokenWhere,
+		},
+		{
+			name:         "null token",
+			filter:       Filters{Name: "brand", Operator: "=", Expression: NewFilterExpression("COALESCE(cars.brand, cars.maker)")},
+			values:       map[string][]string{"brand": {"__NULL__"}},
+			expectedSQL:  []string{"COALESCE(cars.brand, cars.maker) IS NULL"},
+			expectedArgs: [][]any{nil},
+			expectedType: TokenWhere,
+		},
+		{
+			name:         "predicate expression",
+			filter:       Filters{Name: "near", Expression: NewFilterExpression("distance(shops.lat, shops.lng, ?, ?) < ?", 5000)},
+			values:       map[string][]string{"near": {"37.98, 23.72", "1,2,3"}},
+			expectedSQL:  []string{"distance(shops.lat, shops.lng, ?, ?) < ?"},
+			expectedArgs: [][]any{{5000, "37.98", "23.72"}},
+			expectedType: TokenWhere,
+		},
+		{
+			name:         "aggregate expression",
+			filter:       Filters{Name: "avg", Operator: ">", Expression: NewFilterExpression("AVG(COALESCE(cars.price, ?))", 0)},
+			values:       map[string][]string{"avg": {"100"}},
+			expectedSQL:  []string{"AVG(COALESCE(cars.price, ?)) > ?"},
+			expectedArgs: [][]any{{0, "100"}},
+			expectedType: TokenHaving,
+		},
+		{
+			name:         "injection stays bound",
+			filter:       Filters{Name: "name", Operator: "=", Expression: NewFilterExpression("LOWER(cars.name)")},
+			values:       map[string][]string{"name": {"x' OR 1=1 --"}},
+			expectedSQL:  []string{"LOWER(cars.name) = ?"},
+			expectedArgs: [][]any{{"x' OR 1=1 --"}},
+			expectedType: TokenWhere,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionals := BuildFilterConditions([]Filters{tt.filter}, tt.values)
+			assert.Len(t, conditionals, len(tt.expectedSQL))
+			for i, conditional := range conditionals {
+				sql, args, err := conditional.Expresion.ToSql()
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedSQL[i], sql)
+				assert.Equal(t, tt.expectedArgs[i], args)
+				assert.Equal(t, tt.expectedType, conditional.Type)
+			}
+		})
+	}
+}
+
+func TestFilterExpressionIsPredicate(t *testing.T) {
+	assert.False(t, NewFilterExpression("LOWER(name)").IsPredicate())
+	assert.False(t, NewFilterExpression("similarity(name, ?)", "x").IsPredicate())
+	assert.False(t, NewFilterExpression("name = '?'").IsPredicate())
+	assert.True(t, NewFilterExpression("distance(lat, lng, ?, ?) < 10").IsPredicate())
+}
+
+func TestColumnExprAndOrdering(t *testing.T) {
+	filters := []Filters{
+		{Name: "id", Operator: "=", DbField: "cars.id"},
+		{Name: "similar", Operator: ">", Expression: NewFilterExpression("similarity(cars.name, ?)", "model s")},
+		{Name: "near", Expression: NewFilterExpression("distance(lat, lng, ?, ?) < 10")},
+	}
+
+	order, err := OrderExpression("similar", "desc", filters)
+	assert.NoError(t, err)
+	sql, args, err := sq.Select("cars.id").From("cars").OrderByClause(order).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT cars.id FROM cars ORDER BY similarity(cars.name, ?) DESC", sql)
+	assert.Equal(t, []any{"model s"}, args)
+
+	assert.Equal(t, "cars.id ASC", OrderValidation("similar", "", filters), "the bind parameters can not be kept")
+
+	_, err = OrderExpression("near", "asc", filters)
+	assert.Error(t, err)
+
+	q := ApplySearch(filters, sq.Select("*").From("cars"), SearchRequest{Fields: []string{"id", "similar", "near"}})
+	sql, args, err = q.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT (cars.id) AS id, (similarity(cars.name, ?)) AS similar FROM cars", sql)
+	assert.Equal(t, []any{"model s"}, args)
+}
@@ -0,0 +1,102 @@
+package dqk
+
+import (
+	"fmt"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// PermittedFilters returns the filters the user is allowed to use based on Filters.Permission.
+//
+// Filters without a Permission are always kept. Filters whose Permission is not granted are dropped
+// so their params are ignored, except Locked filters & filters with a Default which are kept locked so
+// their Default is still applied. Locked filters whose Permission is granted are unlocked, allowing
+// privileged users to override the Default. The filters kept only for their Default can not be
+// selected or sorted on with SelectFields & ApplySearch.
+//
+// Example:
+//
+//	filters := []Filters{
+//		{Name: "salary", Operator: ">", DbField: "employees.salary", Permission: "view:salaries"},
+//		{Name: "deleted", Operator: "=", DbField: "employees.deleted_at", Default: "__NULL__", Locked: true, Permission: "view:deleted"},
+//	}
+//	q = DynamicFilters(PermittedFilters(filters, userPerms), q, r.URL.Query())
+func PermittedFilters(filters []Filters, perms map[string]bool) []Filters {
+	permitted := make([]Filters, 0, len(filters))
+	for _, filter := range filters {
+		if filter.Permission == "" {
+			permitted = append(permitted, filter)
+			continue
+		}
+		granted := HasPermission(filter.Permission, perms)
+		switch {
+		case filter.Locked && granted:
+			filter.Locked = false
+			permitted = append(permitted, filter)
+		case granted:
+			permitted = append(permitted, filter)
+		case filter.Locked, filter.Default != "":
+			filter.Locked = true
+			filter.restricted = true
+			permitted = append(permitted, filter)
+		}
+	}
+	return permitted
+}
+
+// RejectUnauthorizedFilters returns an error wrapping ErrAccessRestricted for the first param that
+// matches a filter the user is not allowed to use. Use it instead of silently ignoring the filter.
+func RejectUnauthorizedFilters(filters []Filters, params map[string][]string, perms map[string]bool) error {
+	for _, filter := range filters {
+		if filter.Permission == "" || HasPermission(filter.Permission, perms) {
+			continue
+		}
+		for k, v := range params {
+			if strings.EqualFold(k, filter.Name) && len(v) > 0 {
+				return fmt.Errorf("filter %q: %w", filter.Name, ErrAccessRestricted)
+			}
+		}
+	}
+	return nil
+}
+
+// DynamicFiltersWithPermissions applies DynamicFilters with the PermittedFilters of the user
+func DynamicFiltersWithPermissions(f []Filters, q sq.SelectBuilder, queryParams map[string][]string, perms map[string]bool) sq.SelectBuilder {
+	return DynamicFilters(PermittedFilters(f, perms), q, queryParams)
+}
+
+// StripUnauthorizedFields removes the fields the user is not allowed to select from a sparse fieldset.
+// fieldPermissions maps a field name to the permission required to select it, fields that are not
+// in the map are always allowed. Fields backed by filters are also stripped by SelectFields and
+// ApplySearch when they are given the PermittedFilters.
+//
+// Example:
+//
+//	fields := StripUnauthorizedFields([]string{"id", "name", "salary"}, map[string]string{"salary": "view:salaries"}, userPerms)
+//	// → []string{"id", "name"} for users without view:salaries
+func StripUnauthorizedFields(fields []string, fieldPermissions map[string]string, perms map[string]bool) []string {
+	allowed := make([]string, 0, len(fields))
+	for _, field := range fields {
+		permission, ok := fieldPermission(fieldPermissions, field)
+		if ok && !HasPermission(permission, perms) {
+			continue
+		}
+		allowed = append(allowed, field)
+	}
+	return allowed
+}
+
+// fieldPermission looks up the permission of a field case insensitively
+func fieldPermission(fieldPermissions map[string]string, field string) (string, bool) {
+	field = strings.TrimSpace(field)
+	if permission, ok := fieldPermissions[field]; ok {
+		return permission, true
+	}
+	for name, permission := range fieldPermissions {
+		if strings.EqualFold(name, field) {
+			return permission, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,152 @@
+package dqk
+
+import (
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermittedFilters(t *testing.T) {
+	filters := []Filters{
+		{Name: "name", Operator: "=", DbField: "employees.name"},
+		{Name: "salary", Operator: ">", DbField: "employees.salary", Permission: "view:salaries"},
+		{Name: "deleted", Operator: "=", DbField: "employees.deleted_at", Default: "__NULL__", Locked: true, Permission: "view:deleted"},
+		{Name: "status", Operator: "=", DbField: "employees.status", Default: "active", Permission: "view:inactive"},
+	}
+	lockedStatus := Filters{Name: "status", Operator: "=", DbField: "employees.status", Default: "active", Locked: true, Permission: "view:inactive", restricted: true}
+	lockedDeleted := filters[2]
+	lockedDeleted.restricted = true
+	tests := []struct {
+		name        string
+		permissions map[string]bool
+		expected    []Filters
+	}{
+		{
+			name:        "no permissions",
+			permissions: map[string]bool{},
+			expected:    []Filters{filters[0], lockedDeleted, lockedStatus},
+		},
+		{
+			name:        "salary permission",
+			permissions: BuildPermissionSet([]string{"view:salaries"}),
+			expected:    []Filters{filters[0], filters[1], lockedDeleted, lockedStatus},
+		},
+		{
+			name:        "unlock deleted",
+			permissions: BuildPermissionSet([]string{"view:deleted"}),
+			expected: []Filters{
+				filters[0],
+				{Name: "deleted", Operator: "=", DbField: "employees.deleted_at", Default: "__NULL__", Permission: "view:deleted"},
+				lockedStatus,
+			},
+		},
+		{
+			name:        "status permission",
+			permissions: BuildPermissionSet([]string{"view:inactive"}),
+			expected:    []Filters{filters[0], lockedDeleted, filters[3]},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, PermittedFilters(filters, tt.permissions))
+		})
+	}
+}
+
+func TestDynamicFiltersWithPermissions(t *testing.T) {
+	filters := []Filters{
+		{Name: "salary", Operator: ">", DbField: "employees.salary", Permission: "view:salaries"},
+		{Name: "deleted", Operator: "=", DbField: "employees.deleted_at", Default: "__NULL__", Locked: true, Permission: "view:deleted"},
+		{Name: "status", Operator: "=", DbField: "employees.status", Default: "active", Permission: "view:inactive"},
+	}
+	params := map[string][]string{"salary": {"1000"}, "deleted": {"__NOT_NULL__"}, "status": {"inactive"}}
+
+	q := sq.Select("employees.id").From("employees").PlaceholderFormat(sq.Dollar)
+	sql, args, err := DynamicFiltersWithPermissions(filters, q, params, map[string]bool{}).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, "employees.deleted_at IS NULL")
+	assert.Contains(t, sql, "employees.status = $")
+	assert.NotContains(t, sql, "salary")
+	assert.Equal(t, []any{"active"}, args)
+
+	sql, args, err = DynamicFiltersWithPermissions(filters, q, params, BuildPermissionSet([]string{"view:inactive"})).ToSql()
+	assert.NoError(t, err)
+	assert.Contains(t, sql, "employees.status = $")
+	assert.Equal(t, []any{"inactive"}, args)
+
+	err = RejectUnauthorizedFilters(filters, params, map[string]bool{})
+	assert.ErrorIs(t, err, ErrAccessRestricted)
+	assert.NoError(t, RejectUnauthorizedFilters(filters, params, BuildPermissionSet([]string{"view:salaries", "view:deleted", "view:inactive"})))
+	assert.NoError(t, RejectUnauthorizedFilters(filters, map[string][]string{"name": {"a"}}, map[string]bool{}))
+}
+
+func TestPermittedFiltersSearch(t *testing.T) {
+	filters := []Filters{
+		{Name: "id", Operator: "=", DbField: "employees.id"},
+		{Name: "salary", Operator: ">", DbField: "employees.salary", Default: "0", Permission: "view:salaries"},
+	}
+	search := SearchRequest{
+		Fields: []string{"id", "salary"},
+		Sort:   []SearchSort{{Field: "salary", Direction: "DESC"}},
+	}
+	tests := []struct {
+		name         string
+		permissions  map[string]bool
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "gated field",
+			permissions:  map[string]bool{},
+			expectedSQL:  "SELECT (employees.id) AS id FROM employees WHERE employees.salary > ?",
+			expectedArgs: []any{"0"},
+		},
+		{
+			name:         "granted field",
+			permissions:  BuildPermissionSet([]string{"view:salaries"}),
+			expectedSQL:  "SELECT (employees.id) AS id, (employees.salary) AS salary FROM employees WHERE employees.salary > ? ORDER BY employees.salary DESC",
+			expectedArgs: []any{"0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			permitted := PermittedFilters(filters, tt.permissions)
+			sql, args, err := ApplySearch(permitted, sq.Select("*").From("employees"), search).ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+			if len(tt.permissions) == 0 {
+				assert.Equal(t, []string{"employees.id AS id"}, SelectFields(permitted, search.Fields))
+			}
+		})
+	}
+}
+
+func TestStripUnauthorizedFields(t *testing.T) {
+	fieldPermissions := map[string]string{"salary": "view:salaries"}
+	tests := []struct {
+		name        string
+		fields      []string
+		permissions map[string]bool
+		expected    []string
+	}{
+		{
+			name:        "stripped",
+			fields:      []string{"id", "name", "Salary"},
+			permissions: map[string]bool{},
+			expected:    []string{"id", "name"},
+		},
+		{
+			name:        "allowed",
+			fields:      []string{"id", "salary"},
+			permissions: BuildPermissionSet([]string{"view:salaries"}),
+			expected:    []string{"id", "salary"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, StripUnauthorizedFields(tt.fields, fieldPermissions, tt.permissions))
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package dqk
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	// EarthRadius is the mean earth radius in meters used by the haversine formula
+	EarthRadius = 6371008.8
+	// maxRadius is half the earth circumference, any point is within that distance
+	maxRadius = 20037508.34
+)
+
+// GeoColumns are the latitude & longitude columns used when the distance is computed with the
+// haversine formula, which is the case for sqlite or when the filter has no spatial DbField.
+type GeoColumns struct {
+	Latitude  string `json:"latitude" xml:"latitude" yaml:"latitude" csv:"latitude"`
+	Longitude string `json:"longitude" xml:"longitude" yaml:"longitude" csv:"longitude"`
+}
+
+// GeoPoint is a WGS84 coordinate
+type GeoPoint struct {
+	Latitude  float64
+	Longitude float64
+}
+
+// GeoBBox is a bounding box. MinLongitude is greater than MaxLongitude when the box crosses the antimeridian.
+type GeoBBox struct {
+	MinLongitude float64
+	MinLatitude  float64
+	MaxLongitude float64
+	MaxLatitude  float64
+}
+
+// ParseNear parses a near value in the lat,lng,radius format. The radius is in meters
+func ParseNear(value string) (GeoPoint, float64, error) {
+	parts, err := parseFloats(value, 3)
+	if err != nil {
+		return GeoPoint{}, 0, fmt.Errorf("near must be lat,lng,radius: %w", err)
+	}
+	point := GeoPoint{Latitude: parts[0], Longitude: parts[1]}
+	if err := point.Validate(); err != nil {
+		return GeoPoint{}, 0, err
+	}
+	if parts[2] <= 0 || parts[2] > maxRadius {
+		return GeoPoint{}, 0, fmt.Errorf("radius must be between 0 and %.0f meters", maxRadius)
+	}
+	return point, parts[2], nil
+}
+
+// ParseBBox parses a bbox value in the minLng,minLat,maxLng,maxLat format
+func ParseBBox(value string) (GeoBBox, error) {
+	parts, err := parseFloats(value, 4)
+	if err != nil {
+		return GeoBBox{}, fmt.Errorf("bbox must be minLng,minLat,maxLng,maxLat: %w", err)
+	}
+	box := GeoBBox{MinLongitude: parts[0], MinLatitude: parts[1], MaxLongitude: parts[2], MaxLatitude: parts[3]}
+	for _, point := range []GeoPoint{{box.MinLatitude, box.MinLongitude}, {box.MaxLatitude, box.MaxLongitude}} {
+		if err := point.Validate(); err != nil {
+			return GeoBBox{}, err
+		}
+	}
+	if box.MinLatitude > box.MaxLatitude {
+		return GeoBBox{}, fmt.Errorf("bbox min latitude is greater than max latitude")
+	}
+	return box, nil
+}
+
+// Validate checks the point is within the WGS84 ranges
+func (p GeoPoint) Validate() error {
+	if p.Latitude < -90 || p.Latitude > 90 {
+		return fmt.Errorf("latitude must be between -90 and 90")
+	}
+	if p.Longitude < -180 || p.Longitude > 180 {
+		return fmt.Errorf("longitude must be between -180 and 180")
+	}
+	return nil
+}
+
+// CrossesAntimeridian is true when the box wraps around longitude 180
+func (b GeoBBox) CrossesAntimeridian() bool {
+	return b.MinLongitude > b.MaxLongitude
+}
+
+// geoConditions builds the conditions of KindNear & KindBBox filters. Invalid values (or filters without
+// their columns) fail the query on ToSql() so the handler can respond with a bad request
+func geoConditions(filter Filters, clause string, values []string) []Conditional {
+	method := "geoConditions"
+	var conditionals []Conditional
+
+	for _, value := range values {
+		var (
+			condition sq.Sqlizer
+			err       error
+		)
+		switch filter.Kind {
+		case KindNear:
+			condition, err = nearCondition(filter, value)
+		case KindBBox:
+			condition, err = bboxCondition(filter, value)
+		}
+		if err != nil {
+			slog.LogAttrs(context.Background(), slog.LevelDebug, "invalid geo value", slog.String("method", method), slog.String("filter", filter.Name), slog.String("value", value), slog.String("error", err.Error()))
+			condition = invalidCondition{err: fmt.Errorf("invalid %s value %q: %w", filter.Name, value, err)}
+		}
+		conditionals = append(conditionals, NewConditional(condition, clause, values))
+	}
+	return conditionals
+}
+
+// nearCondition returns the within radius condition:
+//   - postgres: ST_DWithin on the DbField cast to geography
+//   - mysql: ST_Distance_Sphere on the DbField, which must have SRID 4326
+//   - otherwise the haversine formula on the Geo columns
+func nearCondition(filter Filters, value string) (sq.Sqlizer, error) {
+	point, radius, err := ParseNear(value)
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.Dialect == DialectPostgres && filter.hasSpatialColumn() {
+		return sq.Expr(fmt.Sprintf("ST_DWithin(%s::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)", filter.DbField), point.Longitude, point.Latitude, radius), nil
+	}
+
+	distance, args, err := distanceExpression(filter, point)
+	if err != nil {
+		return nil, err
+	}
+	within := sq.Expr(fmt.Sprintf("%s <= ?", distance), append(args, radius)...)
+	if filter.hasSpatialColumn() {
+		return within, nil
+	}
+
+	// the latitude range lets the database use an index before computing the distance
+	delta := radius / EarthRadius * 180 / math.Pi
+	return sq.And{
+		sq.Expr(fmt.Sprintf("%s BETWEEN ? AND ?", filter.Geo.Latitude), max(point.Latitude-delta, -90), min(point.Latitude+delta, 90)),
+		within,
+	}, nil
+}
+
+// bboxCondition returns the within bounding box condition:
+//   - postgres: the && operator against ST_MakeEnvelope
+//   - mysql: MBRContains against a polygon
+//   - otherwise BETWEEN on the Geo columns
+func bboxCondition(filter Filters, value string) (sq.Sqlizer, error) {
+	box, err := ParseBBox(value)
+	if err != nil {
+		return nil, err
+	}
+
+	boxes := []GeoBBox{box}
+	if box.CrossesAntimeridian() {
+		boxes = []GeoBBox{
+			{MinLongitude: box.MinLongitude, MinLatitude: box.MinLatitude, MaxLongitude: 180, MaxLatitude: box.MaxLatitude},
+			{MinLongitude: -180, MinLatitude: box.MinLatitude, MaxLongitude: box.MaxLongitude, MaxLatitude: box.MaxLatitude},
+		}
+	}
+
+	if !filter.hasSpatialColumn() {
+		if filter.Geo == nil {
+			return nil, fmt.Errorf("filter %q has no geo columns", filter.Name)
+		}
+		var longitude sq.Sqlizer = sq.Expr(fmt.Sprintf("%s BETWEEN ? AND ?", filter.Geo.Longitude), box.MinLongitude, box.MaxLongitude)
+		if box.CrossesAntimeridian() {
+			longitude = sq.Or{
+				sq.Expr(fmt.Sprintf("%s >= ?", filter.Geo.Longitude), box.MinLongitude),
+				sq.Expr(fmt.Sprintf("%s <= ?", filter.Geo.Longitude), box.MaxLongitude),
+			}
+		}
+		return sq.And{
+			sq.Expr(fmt.Sprintf("%s BETWEEN ? AND ?", filter.Geo.Latitude), box.MinLatitude, box.MaxLatitude),
+			longitude,
+		}, nil
+	}
+
+	conditions := sq.Or{}
+	for _, b := range boxes {
+		switch filter.Dialect {
+		case DialectPostgres:
+			conditions = append(conditions, sq.Expr(fmt.Sprintf("%s::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326)", filter.DbField), b.MinLongitude, b.MinLatitude, b.MaxLongitude, b.MaxLatitude))
+		case DialectMySQL:
+			polygon := fmt.Sprintf("POLYGON((%[1]s %[2]s, %[3]s %[2]s, %[3]s %[4]s, %[1]s %[4]s, %[1]s %[2]s))",
+				formatCoordinate(b.MinLongitude), formatCoordinate(b.MinLatitude), formatCoordinate(b.MaxLongitude), formatCoordinate(b.MaxLatitude))
+			conditions = append(conditions, sq.Expr(fmt.Sprintf("MBRContains(ST_GeomFromText(?, 4326, 'axis-order=long-lat'), %s)", filter.DbField), polygon))
+		}
+	}
+	if len(conditions) == 1 {
+		return conditions[0], nil
+	}
+	return conditions, nil
+}
+
+// distanceExpression returns the distance in meters between the filter location and point
+func distanceExpression(filter Filters, point GeoPoint) (string, []any, error) {
+	if filter.hasSpatialColumn() {
+		switch filter.Dialect {
+		case DialectPostgres:
+			return fmt.Sprintf("ST_Distance(%s::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography)", filter.DbField), []any{point.Longitude, point.Latitude}, nil
+		case DialectMySQL:
+			wkt := fmt.Sprintf("POINT(%s %s)", formatCoordinate(point.Longitude), formatCoordinate(point.Latitude))
+			return fmt.Sprintf("ST_Distance_Sphere(%s, ST_GeomFromText(?, 4326, 'axis-order=long-lat'))", filter.DbField), []any{wkt}, nil
+		}
+	}
+
+	if filter.Geo == nil {
+		return "", nil, fmt.Errorf("filter %q has no geo columns", filter.Name)
+	}
+	lat, lng := filter.Geo.Latitude, filter.Geo.Longitude
+	return fmt.Sprintf("(? * 2 * ASIN(SQRT(POWER(SIN(RADIANS(%[1]s - ?) / 2), 2) + COS(RADIANS(?)) * COS(RADIANS(%[1]s)) * POWER(SIN(RADIANS(%[2]s - ?) / 2), 2))))", lat, lng),
+		[]any{EarthRadius, point.Latitude, point.Latitude, point.Longitude}, nil
+}
+
+// OrderByDistance orders the query by the distance from the point of the near parameter, closest first.
+// The query is returned as is when no valid near parameter is provided.
+func OrderByDistance(filters []Filters, q sq.SelectBuilder, params map[string][]string) sq.SelectBuilder {
+	lowered := map[string][]string{}
+	for k, v := range params {
+		lowered[strings.ToLower(k)] = v
+	}
+
+	for _, filter := range filters {
+		values := lowered[strings.ToLower(filter.Name)]
+		if filter.Kind != KindNear || len(values) == 0 {
+			continue
+		}
+		point, _, err := ParseNear(values[0])
+		if err != nil {
+			continue
+		}
+		distance, args, err := distanceExpression(filter, point)
+		if err != nil {
+			continue
+		}
+		return q.OrderByClause(sq.Expr(fmt.Sprintf("%s ASC", distance), args...))
+	}
+	return q
+}
+
+func (f *Filters) hasSpatialColumn() bool {
+	return f.DbField != "" && (f.Dialect == DialectPostgres || f.Dialect == DialectMySQL)
+}
+
+func parseFloats(value string, expected int) ([]float64, error) {
+	parts := strings.Split(value, ",")
+	if len(parts) != expected {
+		return nil, fmt.Errorf("expected %d values, got %d", expected, len(parts))
+	}
+	floats := make([]float64, 0, expected)
+	for _, part := range parts {
+		f, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil || math.IsNaN(f) || math.IsInf(f, 0) {
+			return nil, fmt.Errorf("%q is not a number", part)
+		}
+		floats = append(floats, f)
+	}
+	return floats, nil
+}
+
+func formatCoordinate(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,166 @@
+package dqk
+
+import (
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseNear(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		point     GeoPoint
+		radius    float64
+		expectErr bool
+	}{
+		{name: "valid", value: "37.98, 23.72,5000", point: GeoPoint{Latitude: 37.98, Longitude: 23.72}, radius: 5000},
+		{name: "missing radius", value: "37.98,23.72", expectErr: true},
+		{name: "latitude out of range", value: "91,23.72,10", expectErr: true},
+		{name: "longitude out of range", value: "37.98,-181,10", expectErr: true},
+		{name: "negative radius", value: "37.98,23.72,-1", expectErr: true},
+		{name: "not a number", value: "NaN,23.72,10", expectErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			point, radius, err := ParseNear(tt.value)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.point, point)
+			assert.Equal(t, tt.radius, radius)
+		})
+	}
+}
+
+func TestParseBBox(t *testing.T) {
+	box, err := ParseBBox("170,-10,-170,10")
+	assert.NoError(t, err)
+	assert.True(t, box.CrossesAntimeridian())
+
+	_, err = ParseBBox("20,40,25,35")
+	assert.Error(t, err)
+
+	_, err = ParseBBox("20,40,25")
+	assert.Error(t, err)
+}
+
+func TestGeoConditions(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       Filters
+		value        string
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "postgres near",
+			filter:       Filters{Name: "near", Kind: KindNear, DbField: "shops.location", Dialect: DialectPostgres},
+			value:        "37.98,23.72,5000",
+			expectedSQL:  "ST_DWithin(shops.location::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography, ?)",
+			expectedArgs: []any{23.72, 37.98, 5000.0},
+		},
+		{
+			name:         "mysql near",
+			filter:       Filters{Name: "near", Kind: KindNear, DbField: "shops.location", Dialect: DialectMySQL},
+			value:        "37.98,23.72,5000",
+			expectedSQL:  "ST_Distance_Sphere(shops.location, ST_GeomFromText(?, 4326, 'axis-order=long-lat')) <= ?",
+			expectedArgs: []any{"POINT(23.72 37.98)", 5000.0},
+		},
+		{
+			name:         "haversine near",
+			filter:       Filters{Name: "near", Kind: KindNear, Dialect: DialectSQLite, Geo: &GeoColumns{Latitude: "shops.lat", Longitude: "shops.lng"}},
+			value:        "0,10,111195.08",
+			expectedSQL:  "(shops.lat BETWEEN ? AND ? AND (? * 2 * ASIN(SQRT(POWER(SIN(RADIANS(shops.lat - ?) / 2), 2) + COS(RADIANS(?)) * COS(RADIANS(shops.lat)) * POWER(SIN(RADIANS(shops.lng - ?) / 2), 2)))) <= ?)",
+			expectedArgs: []any{-1.0000000000000002, 1.0000000000000002, EarthRadius, 0.0, 0.0, 10.0, 111195.08},
+		},
+		{
+			name:         "postgres bbox",
+			filter:       Filters{Name: "bbox", Kind: KindBBox, DbField: "shops.location", Dialect: DialectPostgres},
+			value:        "23,37,24,38",
+			expectedSQL:  "shops.location::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326)",
+			expectedArgs: []any{23.0, 37.0, 24.0, 38.0},
+		},
+		{
+			name:         "postgres bbox across the antimeridian",
+			filter:       Filters{Name: "bbox", Kind: KindBBox, DbField: "shops.location", Dialect: DialectPostgres},
+			value:        "170,-10,-170,10",
+			expectedSQL:  "(shops.location::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326) OR shops.location::geometry && ST_MakeEnvelope(?, ?, ?, ?, 4326))",
+			expectedArgs: []any{170.0, -10.0, 180.0, 10.0, -180.0, -10.0, -170.0, 10.0},
+		},
+		{
+			name:         "mysql bbox",
+			filter:       Filters{Name: "bbox", Kind: KindBBox, DbField: "shops.location", Dialect: DialectMySQL},
+			value:        "23,37,24.5,38",
+			expectedSQL:  "MBRContains(ST_GeomFromText(?, 4326, 'axis-order=long-lat'), shops.location)",
+			expectedArgs: []any{"POLYGON((23 37, 24.5 37, 24.5 38, 23 38, 23 37))"},
+		},
+		{
+			name:         "plain bbox across the antimeridian",
+			filter:       Filters{Name: "bbox", Kind: KindBBox, Geo: &GeoColumns{Latitude: "shops.lat", Longitude: "shops.lng"}},
+			value:        "170,-10,-170,10",
+			expectedSQL:  "(shops.lat BETWEEN ? AND ? AND (shops.lng >= ? OR shops.lng <= ?))",
+			expectedArgs: []any{-10.0, 10.0, 170.0, -170.0},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionals := BuildFilterConditions([]Filters{tt.filter}, map[string][]string{tt.filter.Name: {tt.value}})
+			assert.Len(t, conditionals, 1)
+			sql, args, err := conditionals[0].Expresion.ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.InDeltaSlice(t, floatsOnly(tt.expectedArgs), floatsOnly(args), 1e-6)
+			assert.Equal(t, len(tt.expectedArgs), len(args))
+			assert.Equal(t, TokenWhere, conditionals[0].Type)
+		})
+	}
+}
+
+func TestGeoConditionsInvalidValues(t *testing.T) {
+	filters := []Filters{
+		{Name: "near", Kind: KindNear, DbField: "shops.location", Dialect: DialectPostgres},
+		{Name: "bbox", Kind: KindBBox},
+	}
+	tests := []struct {
+		name   string
+		params map[string][]string
+	}{
+		{name: "latitude out of range", params: map[string][]string{"near": {"999,0,5"}}},
+		{name: "malformed near", params: map[string][]string{"near": {"37.98,23.72"}}},
+		{name: "bbox without geo columns", params: map[string][]string{"bbox": {"23,37,24,38"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, err := DynamicFilters(filters, sq.Select("shops.id").From("shops"), tt.params).ToSql()
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestOrderByDistance(t *testing.T) {
+	filters := []Filters{
+		{Name: "near", Kind: KindNear, DbField: "shops.location", Dialect: DialectPostgres},
+	}
+	q := sq.Select("shops.id").From("shops")
+
+	sql, args, err := OrderByDistance(filters, q, map[string][]string{"near": {"37.98,23.72,5000"}}).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT shops.id FROM shops ORDER BY ST_Distance(shops.location::geography, ST_SetSRID(ST_MakePoint(?, ?), 4326)::geography) ASC", sql)
+	assert.Equal(t, []any{23.72, 37.98}, args)
+
+	assert.Equal(t, q, OrderByDistance(filters, q, map[string][]string{}))
+}
+
+func floatsOnly(values []any) []float64 {
+	floats := []float64{}
+	for _, value := range values {
+		if f, ok := value.(float64); ok {
+			floats = append(floats, f)
+		}
+	}
+	return floats
+}
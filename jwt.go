@@ -0,0 +1,478 @@
+package dqk
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	subjectKey contextKey = "dqk_subject"
+	claimsKey  contextKey = "dqk_claims"
+)
+
+// ErrInvalidToken is wrapped by every token validation error of JWTVerifier
+var ErrInvalidToken = errors.New("invalid token")
+
+// JWTConfig configures a JWTVerifier. HS256 tokens are verified with Secret, RS256 & ES256 tokens with
+// the key matching their kid header from Keys, JWKSFile or JWKSURL (a single key is used for tokens without kid).
+type JWTConfig struct {
+	// Secret is the HS256 shared secret, HS256 tokens are rejected when it is empty
+	Secret []byte
+	// Keys are RS256 (*rsa.PublicKey) & ES256 (*ecdsa.PublicKey) keys by kid
+	Keys map[string]crypto.PublicKey
+	// JWKSFile is a path to a JSON Web Key Set
+	JWKSFile string
+	// JWKSURL is fetched on start and again, at most once per JWKSRefresh, when a token has an unknown kid
+	// or its keys are older than JWKSRefresh. Each fetch replaces its keys, so keys removed from the set
+	// stop being trusted
+	JWKSURL string
+	// JWKSRefresh is the minimum time between JWKSURL fetches, 5 minutes by default
+	JWKSRefresh time.Duration
+	// Issuer must match the iss claim when set
+	Issuer string
+	// Audience must be one of the aud claim values when set
+	Audience string
+	// Leeway is the allowed clock skew for exp, nbf & iat
+	Leeway time.Duration
+	// PermissionsClaim holds the permissions as an array or a space separated string, "permissions" by default
+	PermissionsClaim string
+	// Now returns the current time, time.Now by default
+	Now func() time.Time
+	// Client fetches JWKSURL, a client with a 10 seconds timeout by default
+	Client *http.Client
+}
+
+// JWTClaims are the validated claims of a token. Claims has every claim as decoded from JSON
+type JWTClaims struct {
+	Subject     string
+	Issuer      string
+	Audience    []string
+	ExpiresAt   time.Time
+	NotBefore   time.Time
+	IssuedAt    time.Time
+	Permissions []string
+	Claims      map[string]any
+}
+
+// JWTVerifier validates bearer tokens. It is safe for concurrent use.
+type JWTVerifier struct {
+	config JWTConfig
+
+	mu sync.RWMutex
+	// keys of Keys & JWKSFile
+	keys map[string]crypto.PublicKey
+	// remoteKeys of JWKSURL, replaced by refresh
+	remoteKeys  map[string]crypto.PublicKey
+	lastRefresh time.Time
+}
+
+// NewJWTVerifier returns a JWTVerifier with the keys of the config loaded
+func NewJWTVerifier(config JWTConfig) (*JWTVerifier, error) {
+	if config.PermissionsClaim == "" {
+		config.PermissionsClaim = "permissions"
+	}
+	if config.JWKSRefresh <= 0 {
+		config.JWKSRefresh = 5 * time.Minute
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	v := &JWTVerifier{config: config, keys: map[string]crypto.PublicKey{}}
+	for kid, key := range config.Keys {
+		v.keys[kid] = key
+	}
+
+	if config.JWKSFile != "" {
+		data, err := os.ReadFile(config.JWKSFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading jwks file: %w", err)
+		}
+		keys, err := ParseJWKS(data)
+		if err != nil {
+			return nil, err
+		}
+		for kid, key := range keys {
+			v.keys[kid] = key
+		}
+	}
+
+	if config.JWKSURL != "" {
+		if err := v.refresh(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(v.keys) == 0 && len(v.remoteKeys) == 0 && len(config.Secret) == 0 {
+		return nil, fmt.Errorf("jwt verifier has no secret or keys")
+	}
+	return v, nil
+}
+
+// refresh fetches JWKSURL and replaces its keys
+func (v *JWTVerifier) refresh() error {
+	v.mu.Lock()
+	v.lastRefresh = v.config.Now()
+	v.mu.Unlock()
+
+	resp, err := v.config.Client.Get(v.config.JWKSURL)
+	if err != nil {
+		return fmt.Errorf("fetching jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("fetching jwks: unexpected status %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("fetching jwks: %w", err)
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return err
+	}
+
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.remoteKeys = keys
+	return nil
+}
+
+// key returns the key for the kid, refreshing JWKSURL for unknown kids and stale keys
+func (v *JWTVerifier) key(kid string) (crypto.PublicKey, bool) {
+	v.mu.RLock()
+	key, remote, ok := v.lookup(kid)
+	canRefresh := v.config.JWKSURL != "" && v.config.Now().Sub(v.lastRefresh) >= v.config.JWKSRefresh
+	v.mu.RUnlock()
+
+	if (ok && !remote) || !canRefresh {
+		return key, ok
+	}
+	if err := v.refresh(); err != nil {
+		// known keys are kept while the JWKS is unavailable
+		slog.LogAttrs(context.Background(), slog.LevelWarn, "failed to refresh jwks", slog.String("method", "JWTVerifier.key"), slog.String("error", err.Error()))
+		return key, ok
+	}
+
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	key, _, ok = v.lookup(kid)
+	return key, ok
+}
+
+// lookup returns the key for the kid and whether it comes from JWKSURL, the lock must be held.
+// Tokens without kid use the only key when there is a single one
+func (v *JWTVerifier) lookup(kid string) (crypto.PublicKey, bool, bool) {
+	if key, ok := v.keys[kid]; ok {
+		return key, false, true
+	}
+	if key, ok := v.remoteKeys[kid]; ok {
+		return key, true, true
+	}
+	if kid != "" || len(v.keys)+len(v.remoteKeys) != 1 {
+		return nil, false, false
+	}
+	for _, key := range v.keys {
+		return key, false, true
+	}
+	for _, key := range v.remoteKeys {
+		return key, true, true
+	}
+	return nil, false, false
+}
+
+// Verify validates the signature and the registered claims of a token
+func (v *JWTVerifier) Verify(token string) (*JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed token", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("%w: header: %v", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: signature: %v", ErrInvalidToken, err)
+	}
+	if err := v.verifySignature(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	claims := map[string]any{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: claims: %v", ErrInvalidToken, err)
+	}
+	result, err := v.validateClaims(claims)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	return result, nil
+}
+
+func (v *JWTVerifier) verifySignature(alg, kid, signed string, signature []byte) error {
+	digest := sha256.Sum256([]byte(signed))
+
+	switch alg {
+	case "HS256":
+		if len(v.config.Secret) == 0 {
+			return fmt.Errorf("HS256 is not enabled")
+		}
+		mac := hmac.New(sha256.New, v.config.Secret)
+		mac.Write([]byte(signed))
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+
+	case "RS256":
+		key, ok := v.key(kid)
+		if !ok {
+			return fmt.Errorf("unknown key %q", kid)
+		}
+		rsaKey, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("key %q is not an RSA key", kid)
+		}
+		if err := rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+
+	case "ES256":
+		key, ok := v.key(kid)
+		if !ok {
+			return fmt.Errorf("unknown key %q", kid)
+		}
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || ecKey.Curve != elliptic.P256() {
+			return fmt.Errorf("key %q is not a P-256 key", kid)
+		}
+		if len(signature) != 64 {
+			return fmt.Errorf("signature mismatch")
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		if !ecdsa.Verify(ecKey, digest[:], r, s) {
+			return fmt.Errorf("signature mismatch")
+		}
+		return nil
+	}
+	return fmt.Errorf("unsupported algorithm %q", alg)
+}
+
+func (v *JWTVerifier) validateClaims(claims map[string]any) (*JWTClaims, error) {
+	now := v.config.Now()
+	leeway := v.config.Leeway
+	result := &JWTClaims{Claims: claims}
+
+	result.Subject, _ = claims["sub"].(string)
+	result.Issuer, _ = claims["iss"].(string)
+	switch aud := claims["aud"].(type) {
+	case string:
+		result.Audience = []string{aud}
+	case []any:
+		result.Audience = stringValues(aud)
+	}
+
+	var ok bool
+	if result.ExpiresAt, ok = numericDate(claims["exp"]); ok && !now.Before(result.ExpiresAt.Add(leeway)) {
+		return nil, fmt.Errorf("token expired")
+	}
+	if result.NotBefore, ok = numericDate(claims["nbf"]); ok && now.Add(leeway).Before(result.NotBefore) {
+		return nil, fmt.Errorf("token not valid yet")
+	}
+	if result.IssuedAt, ok = numericDate(claims["iat"]); ok && now.Add(leeway).Before(result.IssuedAt) {
+		return nil, fmt.Errorf("token issued in the future")
+	}
+	if v.config.Issuer != "" && result.Issuer != v.config.Issuer {
+		return nil, fmt.Errorf("unexpected issuer %q", result.Issuer)
+	}
+	if v.config.Audience != "" && !slices.Contains(result.Audience, v.config.Audience) {
+		return nil, fmt.Errorf("unexpected audience %v", result.Audience)
+	}
+
+	switch perms := claims[v.config.PermissionsClaim].(type) {
+	case string:
+		result.Permissions = strings.Fields(perms)
+	case []any:
+		result.Permissions = stringValues(perms)
+	}
+	return result, nil
+}
+
+// Middleware validates the bearer token of the Authorization header and stores the subject, the claims
+// and the permission set (see BuildPermissionSet) in the request context. Requests without a valid
+// token get 401 Unauthorized.
+//
+// Example:
+//
+//	verifier, err := NewJWTVerifier(JWTConfig{JWKSURL: "http://auth.local/.well-known/jwks.json", Audience: "api"})
+//	stack := CreateStack(Logging, verifier.Middleware, RequirePermission("view:users"))
+func (v *JWTVerifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := BearerToken(r)
+		if !ok {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeErrorResponse(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+		claims, err := v.Verify(token)
+		if err != nil {
+			slog.LogAttrs(r.Context(), slog.LevelDebug, "invalid token", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeErrorResponse(w, r, http.StatusUnauthorized, http.StatusText(http.StatusUnauthorized))
+			return
+		}
+
+		AccessLogFromContext(r.Context()).SetSubject(claims.Subject)
+		ctx := WithSubject(r.Context(), claims.Subject)
+		ctx = context.WithValue(ctx, claimsKey, claims)
+		ctx = WithPermissions(ctx, BuildPermissionSet(claims.Permissions))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// BearerToken returns the token of an "Authorization: Bearer <token>" header
+func BearerToken(r *http.Request) (string, bool) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+// WithSubject returns a copy of ctx carrying the authenticated subject.
+// Use AccessLog.SetSubject to also report it to a NewLogging running before authentication
+func WithSubject(ctx context.Context, subject string) context.Context {
+	return context.WithValue(ctx, subjectKey, subject)
+}
+
+// SubjectFromContext returns the subject stored with WithSubject
+func SubjectFromContext(ctx context.Context) (string, bool) {
+	subject, ok := ctx.Value(subjectKey).(string)
+	return subject, ok && subject != ""
+}
+
+// ClaimsFromContext returns the claims stored by JWTVerifier.Middleware
+func ClaimsFromContext(ctx context.Context) (*JWTClaims, bool) {
+	claims, ok := ctx.Value(claimsKey).(*JWTClaims)
+	return claims, ok && claims != nil
+}
+
+// ParseJWKS returns the RSA & P-256 EC keys of a JSON Web Key Set by kid. Other keys are ignored.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("decoding jwks: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		switch jwk.Kty {
+		case "RSA":
+			n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+			}
+			e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+			}
+			exponent := new(big.Int).SetBytes(e)
+			if !exponent.IsInt64() || exponent.Int64() < 3 || exponent.Int64() > 1<<31-1 {
+				return nil, fmt.Errorf("jwk %q: invalid exponent", jwk.Kid)
+			}
+			keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+
+		case "EC":
+			if jwk.Crv != "P-256" {
+				continue
+			}
+			x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+			}
+			y, err := base64.RawURLEncoding.DecodeString(jwk.Y)
+			if err != nil {
+				return nil, fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+			}
+			if len(x) != 32 || len(y) != 32 {
+				return nil, fmt.Errorf("jwk %q: invalid P-256 coordinates", jwk.Kid)
+			}
+			// ecdh validates that the point is on the curve
+			if _, err := ecdh.P256().NewPublicKey(append(append([]byte{4}, x...), y...)); err != nil {
+				return nil, fmt.Errorf("jwk %q: %w", jwk.Kid, err)
+			}
+			keys[jwk.Kid] = &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		}
+	}
+	return keys, nil
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func numericDate(value any) (time.Time, bool) {
+	seconds, ok := value.(float64)
+	if !ok {
+		return time.Time{}, false
+	}
+	return time.Unix(int64(seconds), 0), true
+}
+
+func stringValues(values []any) []string {
+	result := make([]string, 0, len(values))
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
@@ -0,0 +1,219 @@
+package dqk
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func signTestJWT(t *testing.T, alg, kid string, key any, claims map[string]any) string {
+	t.Helper()
+	header, err := json.Marshal(map[string]string{"alg": alg, "typ": "JWT", "kid": kid})
+	require.NoError(t, err)
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+
+	var signature []byte
+	switch k := key.(type) {
+	case []byte:
+		mac := hmac.New(sha256.New, k)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest[:])
+		require.NoError(t, err)
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func testJWKS(t *testing.T, rsaKey *rsa.PrivateKey, ecKey *ecdsa.PrivateKey) []byte {
+	t.Helper()
+	encode := func(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{
+		{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encode(rsaKey.N.Bytes()), "e": encode(big.NewInt(int64(rsaKey.E)).Bytes())},
+		{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encode(ecKey.X.FillBytes(make([]byte, 32))), "y": encode(ecKey.Y.FillBytes(make([]byte, 32)))},
+	}})
+	require.NoError(t, err)
+	return jwks
+}
+
+func TestJWTVerifier(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	secret := []byte("secret")
+
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(path, testJWKS(t, rsaKey, ecKey), 0o600))
+
+	now := time.Unix(1700000000, 0)
+	verifier, err := NewJWTVerifier(JWTConfig{
+		Secret:   secret,
+		JWKSFile: path,
+		Issuer:   "auth",
+		Audience: "api",
+		Leeway:   30 * time.Second,
+		Now:      func() time.Time { return now },
+	})
+	require.NoError(t, err)
+
+	valid := func() map[string]any {
+		return map[string]any{"sub": "user-1", "iss": "auth", "aud": []string{"api", "web"}, "exp": now.Add(time.Minute).Unix(), "permissions": []string{"view:users"}}
+	}
+	with := func(key string, value any) map[string]any {
+		claims := valid()
+		claims[key] = value
+		return claims
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		valid bool
+	}{
+		{name: "HS256", token: signTestJWT(t, "HS256", "", secret, valid()), valid: true},
+		{name: "RS256", token: signTestJWT(t, "RS256", "rsa", rsaKey, valid()), valid: true},
+		{name: "ES256", token: signTestJWT(t, "ES256", "ec", ecKey, valid()), valid: true},
+		{name: "wrong secret", token: signTestJWT(t, "HS256", "", []byte("other"), valid()), valid: false},
+		{name: "wrong key", token: signTestJWT(t, "ES256", "ec", otherKey, valid()), valid: false},
+		{name: "unknown kid", token: signTestJWT(t, "RS256", "missing", rsaKey, valid()), valid: false},
+		{name: "key type mismatch", token: signTestJWT(t, "RS256", "ec", rsaKey, valid()), valid: false},
+		{name: "none", token: signTestJWT(t, "none", "", nil, valid()), valid: false},
+		{name: "expired", token: signTestJWT(t, "HS256", "", secret, with("exp", now.Add(-time.Minute).Unix())), valid: false},
+		{name: "expired within leeway", token: signTestJWT(t, "HS256", "", secret, with("exp", now.Add(-10*time.Second).Unix())), valid: true},
+		{name: "not before", token: signTestJWT(t, "HS256", "", secret, with("nbf", now.Add(time.Minute).Unix())), valid: false},
+		{name: "wrong issuer", token: signTestJWT(t, "HS256", "", secret, with("iss", "other")), valid: false},
+		{name: "wrong audience", token: signTestJWT(t, "HS256", "", secret, with("aud", "web")), valid: false},
+		{name: "malformed", token: "abc.def", valid: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifier.Verify(tt.token)
+			if !tt.valid {
+				assert.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, "user-1", claims.Subject)
+			assert.Equal(t, []string{"view:users"}, claims.Permissions)
+		})
+	}
+}
+
+func TestJWTMiddleware(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(testJWKS(t, rsaKey, ecKey))
+	}))
+	defer server.Close()
+
+	verifier, err := NewJWTVerifier(JWTConfig{JWKSURL: server.URL, PermissionsClaim: "scope"})
+	require.NoError(t, err)
+
+	handler := CreateStack(verifier.Middleware, RequirePermission("view:users"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		subject, ok := SubjectFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, "user-1", subject)
+		claims, ok := ClaimsFromContext(r.Context())
+		assert.True(t, ok)
+		assert.Equal(t, []string{"view:users", "edit:users"}, claims.Permissions)
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	tests := []struct {
+		name     string
+		header   string
+		expected int
+	}{
+		{name: "valid", header: "Bearer " + signTestJWT(t, "ES256", "ec", ecKey, map[string]any{"sub": "user-1", "scope": "view:users edit:users"}), expected: http.StatusOK},
+		{name: "missing permission", header: "Bearer " + signTestJWT(t, "ES256", "ec", ecKey, map[string]any{"sub": "user-1", "scope": "edit:users"}), expected: http.StatusForbidden},
+		{name: "no token", header: "", expected: http.StatusUnauthorized},
+		{name: "basic auth", header: "Basic dXNlcjpwYXNz", expected: http.StatusUnauthorized},
+		{name: "invalid token", header: "Bearer abc.def.ghi", expected: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.expected == http.StatusUnauthorized {
+				assert.Contains(t, w.Header().Get("WWW-Authenticate"), "Bearer")
+			}
+		})
+	}
+}
+
+func TestJWTVerifierKeyRotation(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	rotatedKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	staticKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	current := ecKey
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write(testJWKS(t, rsaKey, current))
+	}))
+	defer server.Close()
+
+	now := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	verifier, err := NewJWTVerifier(JWTConfig{
+		JWKSURL:     server.URL,
+		JWKSRefresh: time.Minute,
+		Keys:        map[string]crypto.PublicKey{"static": &staticKey.PublicKey},
+		Now:         func() time.Time { return now },
+	})
+	require.NoError(t, err)
+
+	claims := map[string]any{"sub": "user-1"}
+	_, err = verifier.Verify(signTestJWT(t, "ES256", "ec", ecKey, claims))
+	assert.NoError(t, err)
+
+	current = rotatedKey
+	_, err = verifier.Verify(signTestJWT(t, "ES256", "ec", ecKey, claims))
+	assert.NoError(t, err, "the keys are not refreshed before JWKSRefresh")
+
+	now = now.Add(time.Minute)
+	_, err = verifier.Verify(signTestJWT(t, "ES256", "ec", ecKey, claims))
+	assert.ErrorIs(t, err, ErrInvalidToken, "keys removed from the jwks are no longer trusted")
+	_, err = verifier.Verify(signTestJWT(t, "ES256", "ec", rotatedKey, claims))
+	assert.NoError(t, err)
+	_, err = verifier.Verify(signTestJWT(t, "ES256", "static", staticKey, claims))
+	assert.NoError(t, err, "configured keys are kept")
+}
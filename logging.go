@@ -0,0 +1,247 @@
+package dqk
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+)
+
+// LoggingConfig configures NewLogging
+type LoggingConfig struct {
+	// Logger defaults to slog.Default()
+	Logger *slog.Logger `json:"-" xml:"-" yaml:"-" csv:"-"`
+	// Level of successful requests, 5xx responses are always logged as errors
+	Level slog.Level `json:"level" xml:"level" yaml:"level" csv:"level"`
+	// TrustedProxies are the CIDRs (or single IPs) allowed to set X-Forwarded-For
+	TrustedProxies []string `json:"trusted_proxies" xml:"trusted_proxies" yaml:"trusted_proxies" csv:"trusted_proxies"`
+	// RequestIDHeader is read when the request has no request ID in its context (see RequestID), X-Request-ID by default
+	RequestIDHeader string `json:"request_id_header" xml:"request_id_header" yaml:"request_id_header" csv:"request_id_header"`
+	// SampleRate is the share of requests logged between 0 and 1. 0 logs every request,
+	// 5xx responses are always logged
+	SampleRate float64 `json:"sample_rate" xml:"sample_rate" yaml:"sample_rate" csv:"sample_rate"`
+	// ExcludePaths are not logged, ie. /health. A trailing * excludes the prefix, ie. /static/*
+	ExcludePaths []string `json:"exclude_paths" xml:"exclude_paths" yaml:"exclude_paths" csv:"exclude_paths"`
+}
+
+const accessLogKey contextKey = "dqk_access_log"
+
+// AccessLog holds the values reported to NewLogging by handlers further down the stack,
+// ie. the subject set by authentication middlewares that run after the logger
+type AccessLog struct {
+	mu      sync.Mutex
+	subject string
+}
+
+// AccessLogFromContext returns the AccessLog of the request, nil when NewLogging is not in the stack.
+// The methods of a nil AccessLog do nothing
+func AccessLogFromContext(ctx context.Context) *AccessLog {
+	log, _ := ctx.Value(accessLogKey).(*AccessLog)
+	return log
+}
+
+// SetSubject sets the subject of the access log line
+func (l *AccessLog) SetSubject(subject string) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.subject = subject
+}
+
+// Subject returns the subject set with SetSubject
+func (l *AccessLog) Subject() string {
+	if l == nil {
+		return ""
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.subject
+}
+
+// responseRecorder captures the status & size of a response
+type responseRecorder struct {
+	http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
+}
+
+func newResponseRecorder(w http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.status = status
+		rec.wroteHeader = true
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.wroteHeader = true
+	n, err := rec.ResponseWriter.Write(b)
+	rec.size += n
+	return n, err
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rec *responseRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// Flush implements http.Flusher for streaming handlers (ie. server sent events), it does nothing
+// when the underlying writer can not flush
+func (rec *responseRecorder) Flush() {
+	rec.wroteHeader = true
+	http.NewResponseController(rec.ResponseWriter).Flush()
+}
+
+// Hijack implements http.Hijacker for websocket handlers
+func (rec *responseRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(rec.ResponseWriter).Hijack()
+	if err == nil {
+		rec.wroteHeader = true
+		rec.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// NewLogging returns an access log middleware. Every request is logged with the request context
+// so slog handlers can attach trace data, with its method, path, status, size, duration,
+// client ip, user agent, request ID and subject. The subject is read from the context
+// (see SubjectFromContext) when the logger runs after authentication, otherwise from the AccessLog
+// the authentication middlewares report it to.
+//
+// Example:
+//
+//	logging := NewLogging(LoggingConfig{TrustedProxies: []string{"10.0.0.0/8"}, ExcludePaths: []string{"/health"}, SampleRate: 0.1})
+//	stack := CreateStack(logging, NewCors(corsConfig))
+func NewLogging(config LoggingConfig) Middleware {
+	proxies := parsePrefixes(config.TrustedProxies)
+	header := valueOrDefault(config.RequestIDHeader, "X-Request-ID")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if excludedPath(config.ExcludePaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			start := time.Now()
+			rec := newResponseRecorder(w)
+			// authentication middlewares further down the stack report the subject to the access log
+			accessLog := &AccessLog{}
+			next.ServeHTTP(rec, r.WithContext(context.WithValue(r.Context(), accessLogKey, accessLog)))
+
+			level := config.Level
+			if rec.status >= http.StatusInternalServerError {
+				level = slog.LevelError
+			} else if config.SampleRate > 0 && config.SampleRate < 1 && rand.Float64() >= config.SampleRate {
+				return
+			}
+
+			logger := config.Logger
+			if logger == nil {
+				logger = slog.Default()
+			}
+			subject, ok := SubjectFromContext(r.Context())
+			if !ok {
+				subject = accessLog.Subject()
+			}
+			requestID, ok := RequestIDFromContext(r.Context())
+			if !ok {
+				requestID = r.Header.Get(header)
+			}
+			logger.LogAttrs(r.Context(), level, "request",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Int("status", rec.status),
+				slog.Int("size", rec.size),
+				slog.Any("response", time.Since(start)),
+				slog.String("ip", ClientIP(r, proxies)),
+				slog.String("user_agent", r.UserAgent()),
+				slog.String("request_id", requestID),
+				slog.String("subject", subject),
+			)
+		})
+	}
+}
+
+// ClientIP returns the ip of the client. X-Forwarded-For is only used when the request comes from
+// a trusted proxy, the client is the right most address that is not a trusted proxy.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	remote, err := netip.ParseAddr(host)
+	if err != nil || !trusted(trustedProxies, remote) {
+		return host
+	}
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			break
+		}
+		if !trusted(trustedProxies, addr) {
+			return addr.String()
+		}
+		host = addr.String()
+	}
+	return host
+}
+
+func trusted(prefixes []netip.Prefix, addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parsePrefixes parses CIDRs & single IPs, invalid entries are logged and ignored
+func parsePrefixes(values []string) []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, value := range values {
+		value = strings.TrimSpace(value)
+		if prefix, err := netip.ParsePrefix(value); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(value)
+		if err != nil {
+			slog.LogAttrs(context.Background(), slog.LevelWarn, "invalid trusted proxy", slog.String("method", "parsePrefixes"), slog.String("value", value))
+			continue
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes
+}
+
+func excludedPath(excluded []string, path string) bool {
+	for _, pattern := range excluded {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+			continue
+		}
+		if path == pattern {
+			return true
+		}
+	}
+	return false
+}
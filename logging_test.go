@@ -0,0 +1,185 @@
+package dqk
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewLogging(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   LoggingConfig
+		path     string
+		status   int
+		expected map[string]any
+	}{
+		{
+			name:   "captures the response",
+			config: LoggingConfig{TrustedProxies: []string{"10.0.0.0/8", "invalid"}},
+			path:   "/users",
+			status: http.StatusCreated,
+			expected: map[string]any{
+				"level":      "INFO",
+				"method":     "GET",
+				"path":       "/users",
+				"status":     float64(http.StatusCreated),
+				"size":       float64(5),
+				"ip":         "203.0.113.9",
+				"user_agent": "test-agent",
+				"request_id": "req-1",
+				"subject":    "user-1",
+			},
+		},
+		{
+			name:     "excluded path",
+			config:   LoggingConfig{ExcludePaths: []string{"/health", "/static/*"}},
+			path:     "/static/app.js",
+			status:   http.StatusOK,
+			expected: nil,
+		},
+		{
+			name:     "sampled out",
+			config:   LoggingConfig{SampleRate: 1e-12},
+			path:     "/users",
+			status:   http.StatusOK,
+			expected: nil,
+		},
+		{
+			name:     "errors are never sampled out",
+			config:   LoggingConfig{SampleRate: 1e-12},
+			path:     "/users",
+			status:   http.StatusBadGateway,
+			expected: map[string]any{"level": "ERROR", "status": float64(http.StatusBadGateway), "ip": "10.0.0.1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			tt.config.Logger = slog.New(slog.NewJSONHandler(&buf, nil))
+
+			handler := NewLogging(tt.config)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				AccessLogFromContext(r.Context()).SetSubject("user-1")
+				w.WriteHeader(tt.status)
+				w.Write([]byte("hello"))
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			req.Header.Set("X-Forwarded-For", "203.0.113.9, 10.0.0.2")
+			req.Header.Set("X-Request-ID", "req-1")
+			req.Header.Set("User-Agent", "test-agent")
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.expected == nil {
+				assert.Empty(t, buf.String())
+				return
+			}
+			record := map[string]any{}
+			assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+			for key, value := range tt.expected {
+				assert.Equal(t, value, record[key], key)
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	proxies := parsePrefixes([]string{"10.0.0.0/8", "192.168.1.1"})
+	tests := []struct {
+		name      string
+		remote    string
+		forwarded string
+		expected  string
+	}{
+		{name: "no proxy", remote: "203.0.113.9:1234", expected: "203.0.113.9"},
+		{name: "untrusted proxy is ignored", remote: "203.0.113.9:1234", forwarded: "1.1.1.1", expected: "203.0.113.9"},
+		{name: "trusted proxy", remote: "192.168.1.1:1234", forwarded: "1.1.1.1", expected: "1.1.1.1"},
+		{name: "spoofed left most address", remote: "10.0.0.1:1234", forwarded: "6.6.6.6, 1.1.1.1, 10.0.0.2", expected: "1.1.1.1"},
+		{name: "only proxies", remote: "10.0.0.1:1234", forwarded: "10.0.0.3", expected: "10.0.0.3"},
+		{name: "invalid forwarded address", remote: "10.0.0.1:1234", forwarded: "unknown", expected: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.forwarded != "" {
+				req.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			assert.Equal(t, tt.expected, ClientIP(req, proxies))
+		})
+	}
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("192.168.1.1/32")}, proxies)
+}
+
+func TestResponseRecorderUnwrap(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := newResponseRecorder(w)
+	assert.NoError(t, http.NewResponseController(rec).Flush())
+	assert.True(t, w.Flushed)
+}
+
+func TestLoggingAfterAuthentication(t *testing.T) {
+	var buf bytes.Buffer
+	auth := func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(WithSubject(r.Context(), "user-2")))
+		})
+	}
+	logging := NewLogging(LoggingConfig{Logger: slog.New(slog.NewJSONHandler(&buf, nil))})
+	handler := CreateStack(auth, logging)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	record := map[string]any{}
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "user-2", record["subject"])
+	assert.Nil(t, AccessLogFromContext(context.Background()))
+	AccessLogFromContext(context.Background()).SetSubject("ignored")
+}
+
+type hijackRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+func TestResponseRecorderStreaming(t *testing.T) {
+	handler := CreateStack(Logging, Recover)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/ws" {
+			hijacker, ok := w.(http.Hijacker)
+			assert.True(t, ok)
+			_, _, err := hijacker.Hijack()
+			assert.NoError(t, err)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		assert.True(t, ok)
+		w.Write([]byte("data: 1\n\n"))
+		flusher.Flush()
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/events", nil))
+	assert.True(t, w.Flushed)
+
+	hijack := &hijackRecorder{ResponseRecorder: httptest.NewRecorder()}
+	handler.ServeHTTP(hijack, httptest.NewRequest(http.MethodGet, "/ws", nil))
+	assert.True(t, hijack.hijacked)
+}
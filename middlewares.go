@@ -1,23 +1,20 @@
 package dqk
 
 import (
-	"context"
-	"fmt"
 	"log/slog"
 	"net/http"
-	"time"
+	"runtime/debug"
 )
 
-// Logging Provides logging middleware for the app
+// Logging Provides logging middleware for the app. It logs every request with NewLogging defaults
 func Logging(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		start := time.Now()
-		next.ServeHTTP(w, r)
-		slog.LogAttrs(context.Background(), slog.LevelInfo, "request", slog.String("method", r.Method), slog.String("path", fmt.Sprintf("%s", r.URL.Path)), slog.Any("response", time.Since(start)))
-	})
+	return defaultLogging(next)
 }
 
-// Cors adds CORS to all routes in the app
+var defaultLogging = NewLogging(LoggingConfig{})
+
+// Cors adds CORS to all routes in the app. It allows any origin without credentials,
+// use NewCors for an origin allowlist, credentials & preflight responses
 func Cors(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
@@ -28,6 +25,37 @@ func Cors(next http.Handler) http.Handler {
 	})
 }
 
+// Recover catches panics of the next handlers, logs them with their stack and responds with a
+// 500 ErrorResponse encoded with the Accept header of the request. The panic value is never sent
+// to the client. http.ErrAbortHandler is not recovered so the server aborts the response.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := newResponseRecorder(w)
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+
+			slog.LogAttrs(r.Context(), slog.LevelError, "panic recovered",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.Any("panic", recovered),
+				slog.String("stack", string(debug.Stack())),
+			)
+			if rec.wroteHeader {
+				// the response has started, the client gets a truncated response
+				return
+			}
+			writeErrorResponse(w, r, http.StatusInternalServerError, "An unexpected error occurred")
+		}()
+		next.ServeHTTP(rec, r)
+	})
+}
+
 // Middleware takes in a middleware
 type Middleware func(http.Handler) http.Handler
 
@@ -41,3 +69,16 @@ func CreateStack(xs ...Middleware) Middleware {
 		return next
 	}
 }
+
+// writeErrorResponse writes an ErrorResponse encoded with the Accept header of the request
+func writeErrorResponse(w http.ResponseWriter, r *http.Request, status int, message string) {
+	data, contentType, err := DataEncode(AcceptedEncoding(r.Header.Get("Accept")), ErrorResponse{Status: status, Message: message})
+	if err != nil {
+		slog.LogAttrs(r.Context(), slog.LevelError, "failed to encode error response", slog.String("method", "writeErrorResponse"), slog.String("error", err.Error()))
+		http.Error(w, message, status)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(status)
+	w.Write(data)
+}
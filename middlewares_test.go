@@ -1,6 +1,10 @@
 package dqk
 
 import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -71,3 +75,83 @@ func TestCreateStack(t *testing.T) {
 
 	assert.Equal(t, []string{"mw1", "mw2", "handler"}, order)
 }
+
+func TestRecoverMiddleware(t *testing.T) {
+	tests := []struct {
+		name        string
+		accept      string
+		handler     http.HandlerFunc
+		expected    int
+		contentType string
+	}{
+		{
+			name:        "json",
+			accept:      "application/json",
+			handler:     func(http.ResponseWriter, *http.Request) { panic("secret connection string") },
+			expected:    http.StatusInternalServerError,
+			contentType: "application/json",
+		},
+		{
+			name:        "xml",
+			accept:      "application/xml",
+			handler:     func(http.ResponseWriter, *http.Request) { OrderValidation("", "", []Filters{}) },
+			expected:    http.StatusInternalServerError,
+			contentType: "application/xml",
+		},
+		{
+			name:   "no panic",
+			accept: "application/json",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusAccepted)
+			},
+			expected: http.StatusAccepted,
+		},
+		{
+			name:   "response started",
+			accept: "application/json",
+			handler: func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+				panic("late panic")
+			},
+			expected: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			previous := slog.Default()
+			slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+			defer slog.SetDefault(previous)
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.Header.Set("Accept", tt.accept)
+			w := httptest.NewRecorder()
+			Recover(tt.handler).ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, w.Code)
+			if tt.contentType == "" {
+				return
+			}
+			assert.Equal(t, tt.contentType, w.Header().Get("Content-Type"))
+			assert.NotContains(t, w.Body.String(), "secret")
+			assert.Contains(t, buf.String(), "panic recovered")
+
+			var response ErrorResponse
+			if tt.contentType == "application/xml" {
+				assert.NoError(t, xml.Unmarshal(w.Body.Bytes(), &response))
+			} else {
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+			}
+			assert.Equal(t, ErrorResponse{Status: http.StatusInternalServerError, Message: "An unexpected error occurred"}, response)
+		})
+	}
+}
+
+func TestRecoverAbortHandler(t *testing.T) {
+	handler := Recover(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	assert.PanicsWithValue(t, http.ErrAbortHandler, func() {
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	})
+}
@@ -0,0 +1,140 @@
+package dqk
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	OperatorDistinct    = "IS DISTINCT FROM"
+	OperatorNotDistinct = "IS NOT DISTINCT FROM"
+)
+
+var nullTokens = struct {
+	sync.RWMutex
+	null    string
+	notNull string
+}{
+	null:    tokenNull,
+	notNull: tokenNotNull,
+}
+
+// SetNullTokens changes the values that filter for NULL and NOT NULL instead of being compared.
+// The defaults are __NULL__ and __NOT_NULL__. Empty tokens keep the current value.
+func SetNullTokens(null, notNull string) {
+	nullTokens.Lock()
+	defer nullTokens.Unlock()
+	if null != "" {
+		nullTokens.null = null
+	}
+	if notNull != "" {
+		nullTokens.notNull = notNull
+	}
+}
+
+// GetNullTokens returns the current NULL and NOT NULL tokens
+func GetNullTokens() (string, string) {
+	nullTokens.RLock()
+	defer nullTokens.RUnlock()
+	return nullTokens.null, nullTokens.notNull
+}
+
+// isNullToken returns true if value is the NULL or NOT NULL token
+func isNullToken(value string) bool {
+	null, notNull := GetNullTokens()
+	return value == null || value == notNull
+}
+
+// splitNullTokens separates the NULL & NOT NULL tokens from the values to compare
+func splitNullTokens(values []string) (bool, bool, []string) {
+	null, notNull := GetNullTokens()
+	hasNull, hasNotNull := false, false
+	rest := []string{}
+	for _, value := range values {
+		switch value {
+		case null:
+			hasNull = true
+		case notNull:
+			hasNotNull = true
+		default:
+			rest = append(rest, value)
+		}
+	}
+	return hasNull, hasNotNull, rest
+}
+
+// nullOperators returns the null checks requested by the tokens
+func nullOperators(hasNull, hasNotNull bool) []string {
+	operators := []string{}
+	if hasNull {
+		operators = append(operators, "IS NULL")
+	}
+	if hasNotNull {
+		operators = append(operators, "IS NOT NULL")
+	}
+	return operators
+}
+
+// nullCondition returns the IS NULL / IS NOT NULL condition for the column
+// or nil if no token was provided
+func nullCondition(column sq.Sqlizer, hasNull, hasNotNull bool) (sq.Sqlizer, error) {
+	sql, args, err := column.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	conditions := sq.Or{}
+	for _, operator := range nullOperators(hasNull, hasNotNull) {
+		conditions = append(conditions, sq.Expr(fmt.Sprintf("%s %s", sql, operator), args...))
+	}
+	switch len(conditions) {
+	case 0:
+		return nil, nil
+	case 1:
+		return conditions[0], nil
+	}
+	return conditions, nil
+}
+
+// isDistinctOperator returns true for IS DISTINCT FROM & IS NOT DISTINCT FROM
+func isDistinctOperator(operator string) bool {
+	switch normalizeOperator(operator) {
+	case OperatorDistinct, OperatorNotDistinct:
+		return true
+	}
+	return false
+}
+
+// comparison compares a column with a single value. Null safe comparisons are emitted per dialect:
+//   - postgres (and no dialect): column IS [NOT] DISTINCT FROM ?
+//   - mysql: NOT (column <=> ?) / column <=> ?
+//   - sqlite: column IS NOT ? / column IS ?
+func comparison(filter Filters, column string, columnArgs []any, value string) sq.Sqlizer {
+	args := append(append([]any{}, columnArgs...), value)
+	operator := normalizeOperator(filter.Operator)
+	if !isDistinctOperator(operator) {
+		return sq.Expr(fmt.Sprintf("%s %s ?", column, filter.Operator), args...)
+	}
+
+	distinct := operator == OperatorDistinct
+	switch filter.Dialect {
+	case DialectMySQL:
+		if distinct {
+			return sq.Expr(fmt.Sprintf("NOT (%s <=> ?)", column), args...)
+		}
+		return sq.Expr(fmt.Sprintf("%s <=> ?", column), args...)
+	case DialectSQLite:
+		if distinct {
+			return sq.Expr(fmt.Sprintf("%s IS NOT ?", column), args...)
+		}
+		return sq.Expr(fmt.Sprintf("%s IS ?", column), args...)
+	}
+	return sq.Expr(fmt.Sprintf("%s %s ?", column, operator), args...)
+}
+
+func normalizeOperator(operator string) string {
+	return strings.Join(strings.Fields(strings.ToUpper(operator)), " ")
+}
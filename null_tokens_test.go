@@ -0,0 +1,89 @@
+package dqk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNullTokenConditions(t *testing.T) {
+	tests := []struct {
+		name         string
+		filter       Filters
+		values       []string
+		expectedSQL  string
+		expectedArgs []any
+	}{
+		{
+			name:         "value or null",
+			filter:       Filters{Name: "color", Operator: "IN", DbField: "cars.color"},
+			values:       []string{"red", "__NULL__"},
+			expectedSQL:  "(cars.color IN (?) OR cars.color IS NULL)",
+			expectedArgs: []any{"red"},
+		},
+		{
+			name:         "null or not null",
+			filter:       Filters{Name: "color", Operator: "=", DbField: "cars.color"},
+			values:       []string{"__NULL__", "__NOT_NULL__"},
+			expectedSQL:  "(cars.color IS NULL OR cars.color IS NOT NULL)",
+			expectedArgs: nil,
+		},
+		{
+			name:         "expression or null",
+			filter:       Filters{Name: "name", Operator: "=", Expression: NewFilterExpression("LOWER(cars.name)")},
+			values:       []string{"golf", "__NULL__"},
+			expectedSQL:  "(LOWER(cars.name) = ? OR LOWER(cars.name) IS NULL)",
+			expectedArgs: []any{"golf"},
+		},
+		{
+			name:         "distinct postgres",
+			filter:       Filters{Name: "color", Operator: OperatorDistinct, DbField: "cars.color", Dialect: DialectPostgres},
+			values:       []string{"red"},
+			expectedSQL:  "cars.color IS DISTINCT FROM ?",
+			expectedArgs: []any{"red"},
+		},
+		{
+			name:         "distinct mysql",
+			filter:       Filters{Name: "color", Operator: "is distinct from", DbField: "cars.color", Dialect: DialectMySQL},
+			values:       []string{"red"},
+			expectedSQL:  "NOT (cars.color <=> ?)",
+			expectedArgs: []any{"red"},
+		},
+		{
+			name:         "not distinct sqlite",
+			filter:       Filters{Name: "color", Operator: OperatorNotDistinct, DbField: "cars.color", Dialect: DialectSQLite},
+			values:       []string{"red"},
+			expectedSQL:  "cars.color IS ?",
+			expectedArgs: []any{"red"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conditionals := BuildFilterConditions([]Filters{tt.filter}, map[string][]string{tt.filter.Name: tt.values})
+			assert.Len(t, conditionals, 1)
+			sql, args, err := conditionals[0].Expresion.ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestSetNullTokens(t *testing.T) {
+	defer SetNullTokens(tokenNull, tokenNotNull)
+
+	SetNullTokens("null", "")
+	null, notNull := GetNullTokens()
+	assert.Equal(t, "null", null)
+	assert.Equal(t, tokenNotNull, notNull)
+
+	filter := Filters{Name: "color", Operator: "LIKE", DbField: "cars.color"}
+	conditionals := BuildFilterConditions([]Filters{filter}, map[string][]string{"color": {"null"}})
+	assert.Len(t, conditionals, 1)
+	sql, _, err := conditionals[0].Expresion.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "cars.color IS NULL", sql)
+
+	applied := GetParamsApplied([]Filters{filter}, map[string][]string{"color": {"null", "red"}})
+	assert.Equal(t, map[string]string{"cars.color": "IS NULL", "cars.color LIKE": "%red%"}, applied)
+}
@@ -0,0 +1,170 @@
+package dqk
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Attributes are the key/values a Policy is evaluated against, ie. {"department": "sales"}
+type Attributes map[string]any
+
+// AccessRequest is the input of a Policy: who (Subject) wants to do what (Action) on which Resource
+// and in which context (Environment, ie. time or ip).
+type AccessRequest struct {
+	Action      string     `json:"action" xml:"action" yaml:"action" csv:"action"`
+	Subject     Attributes `json:"subject" xml:"-" yaml:"subject" csv:"-"`
+	Resource    Attributes `json:"resource" xml:"-" yaml:"resource" csv:"-"`
+	Environment Attributes `json:"environment" xml:"-" yaml:"environment" csv:"-"`
+}
+
+// Decision is the result of a Policy. Reason explains the decision and can be logged for auditing.
+type Decision struct {
+	Allowed bool   `json:"allowed" xml:"allowed" yaml:"allowed" csv:"allowed"`
+	Reason  string `json:"reason" xml:"reason" yaml:"reason" csv:"reason"`
+}
+
+// Policy decides whether an AccessRequest is allowed
+type Policy interface {
+	Evaluate(req AccessRequest) Decision
+}
+
+// PolicyFunc adapts a function to a Policy
+type PolicyFunc func(req AccessRequest) Decision
+
+// Evaluate implements Policy
+func (f PolicyFunc) Evaluate(req AccessRequest) Decision {
+	return f(req)
+}
+
+// NewPolicy returns a Policy from a predicate. The name is used as the reason of the decision.
+//
+// Example:
+//
+//	sameDepartment := NewPolicy("same department", AttributesEqual("department", "department"))
+//	policy := AllOf(ActionIs("update"), SubjectHasPermission("edit:articles"), sameDepartment, BusinessHours(9, 17))
+//	decision := policy.Evaluate(AccessRequest{Action: "update", Subject: user, Resource: article})
+func NewPolicy(name string, predicate func(req AccessRequest) bool) Policy {
+	return PolicyFunc(func(req AccessRequest) Decision {
+		if predicate(req) {
+			return Decision{Allowed: true, Reason: name}
+		}
+		return Decision{Allowed: false, Reason: fmt.Sprintf("not %s", name)}
+	})
+}
+
+// AllOf allows the request when every policy allows it. The reason of a denial is the reason of the
+// first policy that denied it. AllOf without policies allows every request.
+func AllOf(policies ...Policy) Policy {
+	return PolicyFunc(func(req AccessRequest) Decision {
+		reasons := []string{}
+		for _, policy := range policies {
+			decision := policy.Evaluate(req)
+			if !decision.Allowed {
+				return decision
+			}
+			reasons = append(reasons, decision.Reason)
+		}
+		return Decision{Allowed: true, Reason: joinReasons(reasons, " and ")}
+	})
+}
+
+// AnyOf allows the request when at least one policy allows it, with the reason of that policy.
+// AnyOf without policies denies every request.
+func AnyOf(policies ...Policy) Policy {
+	return PolicyFunc(func(req AccessRequest) Decision {
+		reasons := []string{}
+		for _, policy := range policies {
+			decision := policy.Evaluate(req)
+			if decision.Allowed {
+				return decision
+			}
+			reasons = append(reasons, decision.Reason)
+		}
+		return Decision{Allowed: false, Reason: joinReasons(reasons, " and ")}
+	})
+}
+
+// Not inverts the decision of the policy
+func Not(policy Policy) Policy {
+	return PolicyFunc(func(req AccessRequest) Decision {
+		decision := policy.Evaluate(req)
+		return Decision{Allowed: !decision.Allowed, Reason: fmt.Sprintf("not (%s)", decision.Reason)}
+	})
+}
+
+func joinReasons(reasons []string, sep string) string {
+	if len(reasons) == 0 {
+		return "no policies"
+	}
+	return strings.Join(reasons, sep)
+}
+
+// ActionIs allows the listed actions
+func ActionIs(actions ...string) Policy {
+	return NewPolicy(fmt.Sprintf("action in %v", actions), func(req AccessRequest) bool {
+		return slices.ContainsFunc(actions, func(action string) bool {
+			return strings.EqualFold(action, req.Action)
+		})
+	})
+}
+
+// SubjectHasPermission allows subjects whose "permissions" attribute (a map[string]bool from
+// BuildPermissionSet, a []string or a *PermissionMatcher) grants the permission
+func SubjectHasPermission(perm string) Policy {
+	return NewPolicy(fmt.Sprintf("subject has %s", perm), func(req AccessRequest) bool {
+		switch perms := req.Subject["permissions"].(type) {
+		case map[string]bool:
+			return HasPermission(perm, perms)
+		case []string:
+			return slices.Contains(perms, perm)
+		case *PermissionMatcher:
+			return perms.HasPermission(perm)
+		}
+		return false
+	})
+}
+
+// AttributesEqual returns a predicate that is true when the subject attribute equals the resource attribute,
+// ie. AttributesEqual("id", "owner_id") or AttributesEqual("department", "department").
+// Missing attributes are never equal.
+func AttributesEqual(subjectKey, resourceKey string) func(req AccessRequest) bool {
+	return func(req AccessRequest) bool {
+		subject, ok := req.Subject[subjectKey]
+		if !ok || subject == nil {
+			return false
+		}
+		resource, ok := req.Resource[resourceKey]
+		if !ok || resource == nil {
+			return false
+		}
+		return fmt.Sprint(subject) == fmt.Sprint(resource)
+	}
+}
+
+// IsOwner allows subjects whose "id" attribute equals the ownerKey attribute of the resource
+func IsOwner(ownerKey string) Policy {
+	return NewPolicy(fmt.Sprintf("subject owns resource (%s)", ownerKey), AttributesEqual("id", ownerKey))
+}
+
+// EnvironmentTime returns the "time" attribute of the environment or the current time.
+// Setting the attribute keeps time based policies testable.
+func EnvironmentTime(req AccessRequest) time.Time {
+	if t, ok := req.Environment["time"].(time.Time); ok {
+		return t
+	}
+	return time.Now()
+}
+
+// BusinessHours allows requests from the start hour (inclusive) to the end hour (exclusive)
+// on weekdays, in the location of the environment time
+func BusinessHours(start, end int) Policy {
+	return NewPolicy(fmt.Sprintf("business hours %02d:00-%02d:00", start, end), func(req AccessRequest) bool {
+		now := EnvironmentTime(req)
+		if now.Weekday() == time.Saturday || now.Weekday() == time.Sunday {
+			return false
+		}
+		return now.Hour() >= start && now.Hour() < end
+	})
+}
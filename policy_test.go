@@ -0,0 +1,107 @@
+package dqk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPolicies(t *testing.T) {
+	monday := time.Date(2025, time.March, 3, 10, 0, 0, 0, time.UTC)
+	sunday := time.Date(2025, time.March, 2, 10, 0, 0, 0, time.UTC)
+
+	editorsInDepartment := AllOf(
+		ActionIs("update"),
+		SubjectHasPermission("edit:articles"),
+		NewPolicy("same department", AttributesEqual("department", "department")),
+		BusinessHours(9, 17),
+	)
+	editor := Attributes{"id": 7, "department": "sales", "permissions": BuildPermissionSet([]string{"edit:articles"})}
+
+	tests := []struct {
+		name     string
+		policy   Policy
+		req      AccessRequest
+		expected Decision
+	}{
+		{
+			name:   "allowed",
+			policy: editorsInDepartment,
+			req: AccessRequest{
+				Action:      "update",
+				Subject:     editor,
+				Resource:    Attributes{"department": "sales"},
+				Environment: Attributes{"time": monday},
+			},
+			expected: Decision{Allowed: true, Reason: "action in [update] and subject has edit:articles and same department and business hours 09:00-17:00"},
+		},
+		{
+			name:   "other department",
+			policy: editorsInDepartment,
+			req: AccessRequest{
+				Action:      "update",
+				Subject:     editor,
+				Resource:    Attributes{"department": "hr"},
+				Environment: Attributes{"time": monday},
+			},
+			expected: Decision{Allowed: false, Reason: "not same department"},
+		},
+		{
+			name:   "weekend",
+			policy: editorsInDepartment,
+			req: AccessRequest{
+				Action:      "update",
+				Subject:     editor,
+				Resource:    Attributes{"department": "sales"},
+				Environment: Attributes{"time": sunday},
+			},
+			expected: Decision{Allowed: false, Reason: "not business hours 09:00-17:00"},
+		},
+		{
+			name:     "owner or admin",
+			policy:   AnyOf(IsOwner("author_id"), SubjectHasPermission("admin")),
+			req:      AccessRequest{Subject: Attributes{"id": "7"}, Resource: Attributes{"author_id": 7}},
+			expected: Decision{Allowed: true, Reason: "subject owns resource (author_id)"},
+		},
+		{
+			name:     "neither owner nor admin",
+			policy:   AnyOf(IsOwner("author_id"), SubjectHasPermission("admin")),
+			req:      AccessRequest{Subject: Attributes{"id": 8, "permissions": []string{"view:articles"}}, Resource: Attributes{"author_id": 7}},
+			expected: Decision{Allowed: false, Reason: "not subject owns resource (author_id) and not subject has admin"},
+		},
+		{
+			name:     "not",
+			policy:   Not(ActionIs("delete")),
+			req:      AccessRequest{Action: "DELETE"},
+			expected: Decision{Allowed: false, Reason: "not (action in [delete])"},
+		},
+		{
+			name:     "matcher permissions",
+			policy:   SubjectHasPermission("articles:update"),
+			req:      AccessRequest{Subject: Attributes{"permissions": NewPermissionMatcher([]string{"articles:*"}, nil)}},
+			expected: Decision{Allowed: true, Reason: "subject has articles:update"},
+		},
+		{
+			name:     "missing attributes",
+			policy:   NewPolicy("same department", AttributesEqual("department", "department")),
+			req:      AccessRequest{},
+			expected: Decision{Allowed: false, Reason: "not same department"},
+		},
+		{
+			name:     "empty AllOf",
+			policy:   AllOf(),
+			expected: Decision{Allowed: true, Reason: "no policies"},
+		},
+		{
+			name:     "empty AnyOf",
+			policy:   AnyOf(),
+			expected: Decision{Allowed: false, Reason: "no policies"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.policy.Evaluate(tt.req))
+		})
+	}
+}
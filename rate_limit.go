@@ -0,0 +1,172 @@
+package dqk
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/SteliosGiannatos/DynamicQueryKit/caching"
+)
+
+const (
+	// FixedWindow counts the requests of each window, bursts of up to 2x Limit are possible at the window boundaries
+	FixedWindow = "fixed_window"
+	// SlidingWindow weights the count of the previous window by how much of it overlaps the sliding window
+	SlidingWindow = "sliding_window"
+)
+
+// RateLimitKeyFunc returns the key requests are counted by. Requests are not limited when it returns false
+type RateLimitKeyFunc func(r *http.Request) (string, bool)
+
+// RateLimitConfig configures NewRateLimit
+type RateLimitConfig struct {
+	// Cache holds the counters, use caching.SetUpMemoryDB for a single instance
+	Cache caching.Cache `json:"-" xml:"-" yaml:"-" csv:"-"`
+	// Limit is the number of requests allowed per Window, 60 when it is not positive
+	Limit int `json:"limit" xml:"limit" yaml:"limit" csv:"limit"`
+	// Window defaults to a minute
+	Window time.Duration `json:"window" xml:"window" yaml:"window" csv:"window"`
+	// Algorithm is FixedWindow (default) or SlidingWindow
+	Algorithm string `json:"algorithm" xml:"algorithm" yaml:"algorithm" csv:"algorithm"`
+	// Key defaults to KeyByIP without trusted proxies
+	Key RateLimitKeyFunc `json:"-" xml:"-" yaml:"-" csv:"-"`
+	// Prefix of the counter keys, "ratelimit" by default. Use different prefixes for different limits
+	Prefix string `json:"prefix" xml:"prefix" yaml:"prefix" csv:"prefix"`
+	// Now returns the current time, time.Now by default
+	Now func() time.Time `json:"-" xml:"-" yaml:"-" csv:"-"`
+}
+
+// KeyByIP counts requests by client ip, see ClientIP
+func KeyByIP(trustedProxies ...string) RateLimitKeyFunc {
+	proxies := parsePrefixes(trustedProxies)
+	return func(r *http.Request) (string, bool) {
+		return "ip:" + ClientIP(r, proxies), true
+	}
+}
+
+// KeyByAPIKey counts requests by the API key authenticated with APIKeyAuth, which must run before
+// the limiter. Requests without an authenticated key are counted by client ip (see KeyByIP), so
+// omitting them does not get around the limit. Invalid keys are rejected by APIKeyAuth before they
+// reach the limiter, add a KeyByIP limiter before APIKeyAuth to limit key guessing
+func KeyByAPIKey(trustedProxies ...string) RateLimitKeyFunc {
+	byIP := KeyByIP(trustedProxies...)
+	return func(r *http.Request) (string, bool) {
+		if key, ok := APIKeyFromContext(r.Context()); ok {
+			return "apikey:" + key.Hash, true
+		}
+		return byIP(r)
+	}
+}
+
+// KeyBySubject counts requests by the authenticated subject, see SubjectFromContext
+func KeyBySubject() RateLimitKeyFunc {
+	return func(r *http.Request) (string, bool) {
+		subject, ok := SubjectFromContext(r.Context())
+		return "subject:" + subject, ok
+	}
+}
+
+// NewRateLimit returns a rate limiting middleware. Every response has the RateLimit-Limit,
+// RateLimit-Remaining & RateLimit-Reset (seconds) headers, requests over the limit get
+// 429 Too Many Requests with Retry-After and an ErrorResponse. When the cache fails the request is allowed.
+//
+// Example:
+//
+//	limiter := NewRateLimit(RateLimitConfig{
+//		Cache:     caching.GetCache("redis", &caching.CacheConfig{Prefix: "api"}),
+//		Limit:     100,
+//		Window:    time.Minute,
+//		Algorithm: SlidingWindow,
+//		Key:       KeyBySubject(),
+//	})
+//	stack := CreateStack(Logging, verifier.Middleware, limiter)
+func NewRateLimit(config RateLimitConfig) Middleware {
+	if config.Limit <= 0 {
+		config.Limit = 60
+	}
+	if config.Window <= 0 {
+		config.Window = time.Minute
+	}
+	if config.Key == nil {
+		config.Key = KeyByIP()
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	config.Prefix = valueOrDefault(config.Prefix, "ratelimit")
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, ok := config.Key(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			count, reset, err := config.count(key)
+			if err != nil {
+				slog.LogAttrs(r.Context(), slog.LevelWarn, "rate limit unavailable", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			resetSeconds := strconv.Itoa(int(math.Ceil(reset.Seconds())))
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(config.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(max(config.Limit-count, 0)))
+			w.Header().Set("RateLimit-Reset", resetSeconds)
+			if count > config.Limit {
+				w.Header().Set("Retry-After", resetSeconds)
+				writeErrorResponse(w, r, http.StatusTooManyRequests, http.StatusText(http.StatusTooManyRequests))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// count increments the counter of the key and returns the requests in the window (this one included)
+// and the time until the window resets
+func (c RateLimitConfig) count(key string) (int, time.Duration, error) {
+	now := c.Now()
+	start := now.Truncate(c.Window)
+	reset := start.Add(c.Window).Sub(now)
+	current := fmt.Sprintf("%s:%s:%d", c.Prefix, key, start.Unix())
+
+	ttl := c.Window
+	if c.Algorithm == SlidingWindow {
+		ttl = 2 * c.Window
+	}
+	if err := c.Cache.CacheIncrement(current, ttl); err != nil {
+		return 0, 0, err
+	}
+	count, err := c.counter(current)
+	if err != nil {
+		return 0, 0, err
+	}
+	if c.Algorithm != SlidingWindow {
+		return count, reset, nil
+	}
+
+	previous, err := c.counter(fmt.Sprintf("%s:%s:%d", c.Prefix, key, start.Add(-c.Window).Unix()))
+	if err != nil {
+		return 0, 0, err
+	}
+	overlap := 1 - float64(now.Sub(start))/float64(c.Window)
+	return count + int(math.Ceil(float64(previous)*overlap)), reset, nil
+}
+
+// counter reads a counter, missing counters are 0
+func (c RateLimitConfig) counter(key string) (int, error) {
+	value, err := c.Cache.Get(key)
+	if err != nil || len(value) == 0 {
+		return 0, nil
+	}
+	count, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid rate limit counter %q: %w", key, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,142 @@
+package dqk
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/SteliosGiannatos/DynamicQueryKit/caching"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewRateLimit(t *testing.T) {
+	start := time.Date(2025, time.January, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		algorithm string
+		// requests are sent at these offsets from start
+		offsets  []time.Duration
+		expected []int
+	}{
+		{
+			name:      "fixed window",
+			algorithm: FixedWindow,
+			offsets:   []time.Duration{0, time.Second, 2 * time.Second, 59 * time.Second, 60 * time.Second},
+			expected:  []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests, http.StatusTooManyRequests, http.StatusOK},
+		},
+		{
+			name:      "sliding window",
+			algorithm: SlidingWindow,
+			offsets:   []time.Duration{50 * time.Second, 55 * time.Second, 118 * time.Second},
+			// at 118s 2/60 of the previous window overlaps: 1 + ceil(2*2/60) = 2
+			expected: []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+		{
+			name:      "sliding window limits the boundary burst",
+			algorithm: SlidingWindow,
+			offsets:   []time.Duration{58 * time.Second, 59 * time.Second, 61 * time.Second},
+			// at 61s 59/60 of the previous window overlaps: 1 + ceil(2*59/60) = 3
+			expected: []int{http.StatusOK, http.StatusOK, http.StatusTooManyRequests},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := start
+			handler := NewRateLimit(RateLimitConfig{
+				Cache:     caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"}),
+				Limit:     2,
+				Window:    time.Minute,
+				Algorithm: tt.algorithm,
+				Now:       func() time.Time { return now },
+			})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}))
+
+			for i, offset := range tt.offsets {
+				now = start.Add(offset)
+				req := httptest.NewRequest(http.MethodGet, "/", nil)
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				assert.Equal(t, tt.expected[i], w.Code, "request %d at %s", i, offset)
+				assert.Equal(t, "2", w.Header().Get("RateLimit-Limit"))
+			}
+		})
+	}
+}
+
+func TestRateLimitResponse(t *testing.T) {
+	now := time.Date(2025, time.January, 1, 12, 0, 15, 0, time.UTC)
+	handler := NewRateLimit(RateLimitConfig{
+		Cache:  caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"}),
+		Limit:  1,
+		Window: time.Minute,
+		Key:    KeyBySubject(),
+		Now:    func() time.Time { return now },
+	})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	send := func(subject string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if subject != "" {
+			req = req.WithContext(WithSubject(req.Context(), subject))
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("user-1")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0", w.Header().Get("RateLimit-Remaining"))
+	assert.Equal(t, "45", w.Header().Get("RateLimit-Reset"))
+
+	w = send("user-1")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "45", w.Header().Get("Retry-After"))
+	var response ErrorResponse
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &response))
+	assert.Equal(t, ErrorResponse{Status: http.StatusTooManyRequests, Message: "Too Many Requests"}, response)
+
+	assert.Equal(t, http.StatusOK, send("user-2").Code, "subjects are limited separately")
+	w = send("")
+	assert.Equal(t, http.StatusOK, w.Code, "anonymous requests are not limited by subject")
+	assert.Empty(t, w.Header().Get("RateLimit-Limit"))
+}
+
+func TestRateLimitKeys(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9")
+	req.Header.Set("X-API-Key", "secret")
+
+	key, ok := KeyByIP("10.0.0.0/8")(req)
+	assert.True(t, ok)
+	assert.Equal(t, "ip:203.0.113.9", key)
+
+	key, ok = KeyByAPIKey("10.0.0.0/8")(req)
+	assert.True(t, ok)
+	assert.Equal(t, "ip:203.0.113.9", key, "unauthenticated keys are counted by ip")
+
+	store := NewMemoryAPIKeyStore(APIKey{ID: "1", Hash: HashAPIKey("secret")})
+	limited := APIKeyAuth(APIKeyConfig{Store: store})(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		key, ok = KeyByAPIKey()(r)
+	}))
+	limited.ServeHTTP(httptest.NewRecorder(), req)
+	assert.True(t, ok)
+	assert.Equal(t, "apikey:"+HashAPIKey("secret"), key)
+}
+
+func TestRateLimitDefaults(t *testing.T) {
+	handler := NewRateLimit(RateLimitConfig{Cache: caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})})(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "60", w.Header().Get("RateLimit-Limit"))
+	assert.Equal(t, "59", w.Header().Get("RateLimit-Remaining"))
+}
@@ -0,0 +1,142 @@
+package dqk
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/http"
+)
+
+const requestIDKey contextKey = "dqk_request_id"
+
+// maxRequestIDLength limits the incoming request IDs that are accepted
+const maxRequestIDLength = 128
+
+// RequestIDConfig configures NewRequestID
+type RequestIDConfig struct {
+	// Header is read from the request and echoed in the response, X-Request-ID by default
+	Header string `json:"header" xml:"header" yaml:"header" csv:"header"`
+	// IgnoreIncoming always generates a new ID instead of accepting the one of the request
+	IgnoreIncoming bool `json:"ignore_incoming" xml:"ignore_incoming" yaml:"ignore_incoming" csv:"ignore_incoming"`
+	// Generator returns new IDs, 16 random bytes hex encoded by default
+	Generator func() string `json:"-" xml:"-" yaml:"-" csv:"-"`
+}
+
+// RequestID accepts or generates an X-Request-ID with the NewRequestID defaults
+func RequestID(next http.Handler) http.Handler {
+	return defaultRequestID(next)
+}
+
+var defaultRequestID = NewRequestID(RequestIDConfig{})
+
+// NewRequestID returns a middleware that accepts the request ID of the request header (up to 128 printable
+// characters) or generates one, stores it in the request context and echoes it in the response header.
+// Add it before NewLogging so the access log & every log with the request context carry the same ID.
+//
+// Example:
+//
+//	slog.SetDefault(slog.New(NewContextHandler(slog.NewJSONHandler(os.Stdout, nil))))
+//	stack := CreateStack(RequestID, Logging)
+func NewRequestID(config RequestIDConfig) Middleware {
+	header := valueOrDefault(config.Header, "X-Request-ID")
+	generate := config.Generator
+	if generate == nil {
+		generate = newRequestID
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(header)
+			if config.IgnoreIncoming || !validRequestID(id) {
+				id = generate()
+				r.Header.Set(header, id)
+			}
+			w.Header().Set(header, id)
+			next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), id)))
+		})
+	}
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestIDFromContext returns the request ID stored with WithRequestID
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok && id != ""
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextHandler is a slog.Handler that adds the request ID and the subject of the context
+// to every record, so logs made with the request context can be correlated.
+type ContextHandler struct {
+	handler slog.Handler
+}
+
+// NewContextHandler wraps a slog.Handler with ContextHandler
+func NewContextHandler(handler slog.Handler) *ContextHandler {
+	return &ContextHandler{handler: handler}
+}
+
+// Enabled implements slog.Handler
+func (h *ContextHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return h.handler.Enabled(ctx, level)
+}
+
+// Handle implements slog.Handler
+func (h *ContextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx == nil {
+		return h.handler.Handle(ctx, record)
+	}
+	attrs := []slog.Attr{}
+	if id, ok := RequestIDFromContext(ctx); ok && !hasAttr(record, "request_id") {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if subject, ok := SubjectFromContext(ctx); ok && !hasAttr(record, "subject") {
+		attrs = append(attrs, slog.String("subject", subject))
+	}
+	if len(attrs) > 0 {
+		record = record.Clone()
+		record.AddAttrs(attrs...)
+	}
+	return h.handler.Handle(ctx, record)
+}
+
+// WithAttrs implements slog.Handler
+func (h *ContextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &ContextHandler{handler: h.handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements slog.Handler
+func (h *ContextHandler) WithGroup(name string) slog.Handler {
+	return &ContextHandler{handler: h.handler.WithGroup(name)}
+}
+
+func hasAttr(record slog.Record, key string) bool {
+	found := false
+	record.Attrs(func(attr slog.Attr) bool {
+		found = attr.Key == key
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,91 @@
+package dqk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   RequestIDConfig
+		incoming string
+		expected string
+	}{
+		{name: "accepts incoming", incoming: "abc-123", expected: "abc-123"},
+		{name: "generates", incoming: "", expected: "generated"},
+		{name: "rejects invalid", incoming: "bad id\n", expected: "generated"},
+		{name: "rejects long", incoming: strings.Repeat("a", 129), expected: "generated"},
+		{name: "ignores incoming", config: RequestIDConfig{IgnoreIncoming: true}, incoming: "abc-123", expected: "generated"},
+		{name: "custom header", config: RequestIDConfig{Header: "X-Correlation-ID"}, incoming: "abc-123", expected: "generated"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.config.Generator = func() string { return "generated" }
+			header := valueOrDefault(tt.config.Header, "X-Request-ID")
+
+			var fromContext string
+			handler := NewRequestID(tt.config)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				fromContext, _ = RequestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.incoming != "" {
+				req.Header.Set("X-Request-ID", tt.incoming)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.expected, fromContext)
+			assert.Equal(t, tt.expected, w.Header().Get(header))
+		})
+	}
+
+	handler := RequestID(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Len(t, w.Header().Get("X-Request-ID"), 32)
+}
+
+func TestContextHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil))).With(slog.String("service", "api"))
+
+	ctx := WithSubject(WithRequestID(context.Background(), "req-1"), "user-1")
+	logger.LogAttrs(ctx, slog.LevelInfo, "hello")
+	logger.LogAttrs(context.Background(), slog.LevelInfo, "no request")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 2)
+
+	first := map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &first))
+	assert.Equal(t, "req-1", first["request_id"])
+	assert.Equal(t, "user-1", first["subject"])
+	assert.Equal(t, "api", first["service"])
+
+	second := map[string]any{}
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.NotContains(t, second, "request_id")
+}
+
+func TestDatabaseValidationContext(t *testing.T) {
+	var buf bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(NewContextHandler(slog.NewJSONHandler(&buf, nil))))
+	defer slog.SetDefault(previous)
+
+	status, err := DatabaseValidationContext(WithRequestID(context.Background(), "req-1"), errors.New("Error 1062: Duplicate entry"))
+	assert.Equal(t, http.StatusConflict, status)
+	assert.EqualError(t, err, "Asset already exists")
+	assert.Contains(t, buf.String(), `"request_id":"req-1"`)
+}
@@ -0,0 +1,384 @@
+package dqk
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/SteliosGiannatos/DynamicQueryKit/caching"
+)
+
+// CacheRoute describes a cached endpoint for CacheResponses
+type CacheRoute struct {
+	// Route is the first part of the cache key, ie. "properties"
+	Route string `json:"route" xml:"route" yaml:"route" csv:"route"`
+	// Filters of the endpoint, only their params (and limit & offset) are part of the key
+	Filters []Filters `json:"filters" xml:"filters" yaml:"filters" csv:"filters"`
+	// Params are other query params that change the response,
+	// by default TokenSort, TokenFields, TokenBucket, TokenTZ, order_by & order_direction
+	Params []string `json:"params" xml:"params" yaml:"params" csv:"params"`
+	// AssetIDParam is the path value (see http.Request.PathValue) of the asset ID, ie. "id" for /properties/{id}.
+	// The key & index key are built with GetRouteKey so the asset cache is invalidated on its own
+	AssetIDParam string `json:"asset_id_param" xml:"asset_id_param" yaml:"asset_id_param" csv:"asset_id_param"`
+	// Related are other index keys whose cache depends on this route, they are invalidated by InvalidateCache
+	Related []string `json:"related" xml:"related" yaml:"related" csv:"related"`
+	// TTL of the cached responses, the cache default when nil
+	TTL *time.Duration `json:"ttl" xml:"ttl" yaml:"ttl" csv:"ttl"`
+	// PrivateHeaders identify the caller, requests with any of them are not cached unless Key identifies
+	// the caller. Authorization, X-API-Key & Cookie by default
+	PrivateHeaders []string `json:"private_headers" xml:"private_headers" yaml:"private_headers" csv:"private_headers"`
+	// PrivateParams are the query params that identify the caller, they work like PrivateHeaders.
+	// api_key & access_token by default, list the APIKeyConfig.QueryParam here when it is different
+	PrivateParams []string `json:"private_params" xml:"private_params" yaml:"private_params" csv:"private_params"`
+	// Key is added to the cache key when the response depends on the caller, ie. the subject or
+	// the permissions used by ScopeByOwnership or PermittedFilters. Private requests are only cached
+	// when it returns a non empty key
+	Key func(*http.Request) string `json:"-" xml:"-" yaml:"-" csv:"-"`
+}
+
+// cachedResponse is a response stored by CacheResponses
+type cachedResponse struct {
+	Status       int    `json:"status"`
+	ContentType  string `json:"content_type"`
+	Body         []byte `json:"body"`
+	ETag         string `json:"etag"`
+	LastModified string `json:"last_modified"`
+}
+
+// bodyRecorder keeps a copy of the response body
+type bodyRecorder struct {
+	*responseRecorder
+	body bytes.Buffer
+}
+
+func (rec *bodyRecorder) Write(b []byte) (int, error) {
+	n, err := rec.responseRecorder.Write(b)
+	rec.body.Write(b[:n])
+	return n, err
+}
+
+// CacheKeys returns the cache key of the request and the index key it is registered under.
+// The params are normalized: only the params of the route are used, their names are lowercased
+// and the params & their values are sorted, so ?b=2&a=1 & ?A=1&b=2 share the same key.
+// The encoding of the response (see AcceptedEncoding) and Key are part of the key.
+// ok is false when the asset ID path value is not a number, or when the request is private
+// (see PrivateHeaders & PrivateParams) and Key does not identify the caller.
+func (c CacheRoute) CacheKeys(r *http.Request) (string, string, bool) {
+	var assetID *int
+	if c.AssetIDParam != "" {
+		id, err := strconv.Atoi(r.PathValue(c.AssetIDParam))
+		if err != nil {
+			return "", "", false
+		}
+		assetID = &id
+	}
+
+	params := map[string][]string{}
+	for name, values := range r.URL.Query() {
+		params[strings.ToLower(name)] = append(params[strings.ToLower(name)], values...)
+	}
+
+	allowed := c.Params
+	if allowed == nil {
+		allowed = []string{TokenSort, TokenFields, TokenBucket, TokenTZ, "order_by", "order_direction"}
+	}
+	names := []string{TokenLimit, TokenOffset}
+	for _, name := range allowed {
+		names = append(names, strings.ToLower(name))
+	}
+	for _, filter := range c.Filters {
+		names = append(names, strings.ToLower(filter.Name))
+	}
+	slices.Sort(names)
+	names = slices.Compact(names)
+
+	args := []string{}
+	for _, name := range names {
+		values := []string{}
+		for _, value := range params[name] {
+			if value != "" {
+				// escaped so the separator can not appear in a value, ?a=1,2 & ?a=1&a=2 have different keys
+				values = append(values, url.QueryEscape(value))
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		slices.Sort(values)
+		args = append(args, fmt.Sprintf("%s=%s", name, strings.Join(values, ",")))
+	}
+	args = append(args, fmt.Sprintf("accept=%s", AcceptedEncoding(r.Header.Get("Accept"))))
+	var key string
+	if c.Key != nil {
+		key = c.Key(r)
+	}
+	if key != "" {
+		args = append(args, key)
+	} else if c.isPrivate(r) {
+		return "", "", false
+	}
+
+	routeKey, indexKey := GetRouteKey(c.Route, assetID, args...)
+	return routeKey, indexKey, true
+}
+
+// CacheResponses caches the 200 responses of GET & HEAD requests (status, content type, body,
+// ETag & Last-Modified) and registers their keys in the route index with SetKeyIndex, so they can be
+// invalidated with DeleteCacheIndex. Responses have X-Cache: HIT or MISS. HITs have the stored ETag
+// (the one set by the handler or ETag, otherwise a strong ETag of the body) and conditional requests
+// matching it get 304 Not Modified.
+//
+// The response format depends on the Accept header, so responses have Vary: Accept.
+// Requests with PrivateHeaders or PrivateParams are not cached, since their responses may be scoped
+// to the caller, unless the Key of the route identifies the caller.
+//
+// Requests with Cache-Control: no-cache skip the cached response and refresh it, no-store skips the cache.
+// Responses with Cache-Control: no-store or private are not cached.
+//
+// Example:
+//
+//	cached := CacheResponses(cache, CacheRoute{Route: "properties", Filters: filters, AssetIDParam: "id"})
+//	mux.Handle("GET /properties/{id}", cached(http.HandlerFunc(getProperty)))
+//
+//	owned := CacheResponses(cache, CacheRoute{Route: "bookings", Filters: filters, Key: func(r *http.Request) string {
+//		subject, _ := SubjectFromContext(r.Context())
+//		return "subject=" + subject
+//	}})
+func CacheResponses(cache caching.Cache, route CacheRoute) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next.ServeHTTP(w, r)
+				return
+			}
+			requestDirectives := cacheControl(r.Header)
+			if requestDirectives["no-store"] {
+				next.ServeHTTP(w, r)
+				return
+			}
+			key, indexKey, ok := route.CacheKeys(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Accept")
+
+			if !requestDirectives["no-cache"] {
+				if cached, ok := getCachedResponse(cache, key); ok {
+					w.Header().Set("X-Cache", "HIT")
+					lastModified, _ := http.ParseTime(cached.LastModified)
+					if NotModified(w, r, cached.ETag, lastModified) {
+						return
+					}
+					if cached.ContentType != "" {
+						w.Header().Set("Content-Type", cached.ContentType)
+					}
+					w.WriteHeader(cached.Status)
+					if r.Method != http.MethodHead {
+						w.Write(cached.Body)
+					}
+					return
+				}
+			}
+
+			w.Header().Set("X-Cache", "MISS")
+			rec := &bodyRecorder{responseRecorder: newResponseRecorder(w)}
+			next.ServeHTTP(rec, r)
+
+			responseDirectives := cacheControl(w.Header())
+			if rec.status != http.StatusOK || r.Method == http.MethodHead || responseDirectives["no-store"] || responseDirectives["private"] {
+				return
+			}
+			etag := w.Header().Get("ETag")
+			if etag == "" {
+				etag = ComputeETag(rec.body.Bytes(), false)
+			}
+			data, err := json.Marshal(cachedResponse{
+				Status:       rec.status,
+				ContentType:  w.Header().Get("Content-Type"),
+				Body:         rec.body.Bytes(),
+				ETag:         etag,
+				LastModified: w.Header().Get("Last-Modified"),
+			})
+			if err != nil {
+				return
+			}
+			if err := cache.SetKey(key, string(data), route.TTL); err != nil {
+				slog.LogAttrs(r.Context(), slog.LevelWarn, "failed to cache response", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("key", key), slog.String("error", err.Error()))
+				return
+			}
+			if err := cache.SetKeyIndex(indexKey, key); err != nil {
+				slog.LogAttrs(r.Context(), slog.LevelWarn, "failed to index cached response", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("key", indexKey), slog.String("error", err.Error()))
+			}
+		})
+	}
+}
+
+// isPrivate returns true when the request has any of the PrivateHeaders or PrivateParams
+func (c CacheRoute) isPrivate(r *http.Request) bool {
+	headers := c.PrivateHeaders
+	if headers == nil {
+		headers = []string{"Authorization", "X-API-Key", "Cookie"}
+	}
+	for _, header := range headers {
+		if r.Header.Get(header) != "" {
+			return true
+		}
+	}
+
+	params := c.PrivateParams
+	if params == nil {
+		params = []string{"api_key", "access_token"}
+	}
+	for name, values := range r.URL.Query() {
+		for _, param := range params {
+			if strings.EqualFold(name, param) && slices.ContainsFunc(values, func(value string) bool { return value != "" }) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func getCachedResponse(cache caching.Cache, key string) (cachedResponse, bool) {
+	var cached cachedResponse
+	data, err := cache.Get(key)
+	if err != nil || len(data) == 0 {
+		return cached, false
+	}
+	if err := json.Unmarshal(data, &cached); err != nil || cached.Status == 0 {
+		return cached, false
+	}
+	return cached, true
+}
+
+// cacheControl returns the directives of the Cache-Control header without their values
+func cacheControl(header http.Header) map[string]bool {
+	directives := map[string]bool{}
+	for _, value := range header.Values("Cache-Control") {
+		for _, directive := range strings.Split(value, ",") {
+			name, _, _ := strings.Cut(strings.TrimSpace(directive), "=")
+			directives[strings.ToLower(name)] = true
+		}
+	}
+	if strings.EqualFold(header.Get("Pragma"), "no-cache") {
+		directives["no-cache"] = true
+	}
+	return directives
+}
+
+// IndexKeys returns the index keys invalidated by a write to the route: the index of the asset
+// (when AssetIDParam is set and present), the index of the collection and the Related indexes
+func (c CacheRoute) IndexKeys(r *http.Request) []string {
+	_, collection := GetRouteKey(c.Route, nil)
+	keys := []string{}
+	if c.AssetIDParam != "" {
+		if id, err := strconv.Atoi(r.PathValue(c.AssetIDParam)); err == nil {
+			_, asset := GetRouteKey(c.Route, &id)
+			keys = append(keys, asset)
+		}
+	}
+	keys = append(keys, collection)
+	for _, related := range c.Related {
+		if !slices.Contains(keys, related) {
+			keys = append(keys, related)
+		}
+	}
+	return keys
+}
+
+// InvalidateRoute deletes the cache of the IndexKeys of the request with DeleteCacheIndex and
+// returns the number of keys flushed, ie. for a DeletedCacheResponse
+func InvalidateRoute(cache caching.Cache, route CacheRoute, r *http.Request) (int, error) {
+	flushed := 0
+	var errs []error
+	for _, indexKey := range route.IndexKeys(r) {
+		evicted, err := cache.DeleteCacheIndex(indexKey)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalidating %q: %w", indexKey, err))
+			continue
+		}
+		flushed += evicted
+	}
+	return flushed, errors.Join(errs...)
+}
+
+// InvalidateCache invalidates the route cache (see InvalidateRoute) when successful (2xx)
+// POST, PUT, PATCH & DELETE requests write their status, so write handlers can not forget to invalidate.
+// The cache is invalidated before the response is sent, so clients re-fetching right after it
+// never get a stale cached response.
+//
+// Example:
+//
+//	route := CacheRoute{Route: "properties", AssetIDParam: "id", Related: []string{"owners"}}
+//	mux.Handle("GET /properties/{id}", CacheResponses(cache, route)(getProperty))
+//	mux.Handle("PUT /properties/{id}", InvalidateCache(cache, route)(updateProperty))
+func InvalidateCache(cache caching.Cache, route CacheRoute) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			rec := &invalidationRecorder{ResponseWriter: w, invalidate: func(status int) {
+				if status < 200 || status >= 300 {
+					return
+				}
+				flushed, err := InvalidateRoute(cache, route, r)
+				if err != nil {
+					slog.LogAttrs(r.Context(), slog.LevelError, "failed to invalidate cache", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.String("error", err.Error()))
+					return
+				}
+				slog.LogAttrs(r.Context(), slog.LevelDebug, "cache invalidated", slog.String("method", r.Method), slog.String("path", r.URL.Path), slog.Int("keys flushed", flushed))
+			}}
+			next.ServeHTTP(rec, r)
+			// handlers that write nothing respond with 200
+			rec.writeStatus(http.StatusOK)
+		})
+	}
+}
+
+// invalidationRecorder calls invalidate with the status of the response before it is sent
+type invalidationRecorder struct {
+	http.ResponseWriter
+	invalidate  func(status int)
+	wroteHeader bool
+}
+
+func (rec *invalidationRecorder) writeStatus(status int) {
+	if rec.wroteHeader {
+		return
+	}
+	rec.wroteHeader = true
+	rec.invalidate(status)
+}
+
+func (rec *invalidationRecorder) WriteHeader(status int) {
+	// informational responses are followed by the final status
+	if status >= 200 {
+		rec.writeStatus(status)
+	}
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *invalidationRecorder) Write(b []byte) (int, error) {
+	rec.writeStatus(http.StatusOK)
+	return rec.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the underlying writer
+func (rec *invalidationRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
@@ -0,0 +1,314 @@
+package dqk
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/SteliosGiannatos/DynamicQueryKit/caching"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCacheKeys(t *testing.T) {
+	route := CacheRoute{
+		Route:        "properties",
+		AssetIDParam: "id",
+		Filters: []Filters{
+			{Name: "color", Operator: "IN", DbField: "properties.color"},
+			{Name: "price", Operator: ">", DbField: "properties.price"},
+		},
+	}
+	tests := []struct {
+		name          string
+		target        string
+		id            string
+		accept        string
+		expectedKey   string
+		expectedIndex string
+		ok            bool
+	}{
+		{name: "no params", target: "/properties/1", id: "1", expectedKey: "properties:1:accept=application/json", expectedIndex: "properties:1", ok: true},
+		{
+			name:          "normalized params",
+			target:        "/properties/1?price=5&COLOR=red&color=blue&unknown=1&limit=10&sort=-price",
+			id:            "1",
+			expectedKey:   "properties:1:color=blue,red:limit=10:price=5:sort=-price:accept=application/json",
+			expectedIndex: "properties:1",
+			ok:            true,
+		},
+		{
+			name:          "xml",
+			target:        "/properties/1",
+			id:            "1",
+			accept:        "application/xml",
+			expectedKey:   "properties:1:accept=application/xml",
+			expectedIndex: "properties:1",
+			ok:            true,
+		},
+		{
+			name:          "comma in a value",
+			target:        "/properties/1?color=blue,red",
+			id:            "1",
+			expectedKey:   "properties:1:color=blue%2Cred:accept=application/json",
+			expectedIndex: "properties:1",
+			ok:            true,
+		},
+		{
+			name:          "repeated param",
+			target:        "/properties/1?color=red&color=blue",
+			id:            "1",
+			expectedKey:   "properties:1:color=blue,red:accept=application/json",
+			expectedIndex: "properties:1",
+			ok:            true,
+		},
+		{name: "invalid id", target: "/properties/abc", id: "abc", ok: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, tt.target, nil)
+			req.SetPathValue("id", tt.id)
+			req.Header.Set("Accept", tt.accept)
+			key, index, ok := route.CacheKeys(req)
+			assert.Equal(t, tt.ok, ok)
+			assert.Equal(t, tt.expectedKey, key)
+			assert.Equal(t, tt.expectedIndex, index)
+		})
+	}
+}
+
+func TestCacheResponses(t *testing.T) {
+	cache := caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})
+	calls := 0
+	handler := CacheResponses(cache, CacheRoute{
+		Route:   "cars",
+		Filters: []Filters{{Name: "brand", Operator: "=", DbField: "cars.brand"}},
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch r.URL.Query().Get("brand") {
+		case "missing":
+			w.WriteHeader(http.StatusNotFound)
+			return
+		case "private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"brand":"tesla"}`))
+	}))
+
+	send := func(method, target string, headers map[string]string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send(http.MethodGet, "/cars?brand=tesla", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, 1, calls)
+
+	w = send(http.MethodGet, "/cars?BRAND=tesla&ignored=1", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json", w.Header().Get("Content-Type"))
+	assert.Equal(t, `{"brand":"tesla"}`, w.Body.String())
+	assert.Equal(t, 1, calls)
+
+	w = send(http.MethodGet, "/cars?brand=tesla", map[string]string{"Accept": "application/xml"})
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"), "each encoding is cached on its own")
+	assert.Equal(t, "Accept", w.Header().Get("Vary"))
+	assert.Equal(t, 2, calls)
+
+	w = send(http.MethodHead, "/cars?brand=tesla", nil)
+	assert.Equal(t, "HIT", w.Header().Get("X-Cache"))
+	assert.Empty(t, w.Body.String())
+
+	w = send(http.MethodGet, "/cars?brand=tesla", map[string]string{"Cache-Control": "no-cache"})
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+	assert.Equal(t, 3, calls)
+
+	w = send(http.MethodGet, "/cars?brand=tesla", map[string]string{"Cache-Control": "no-store"})
+	assert.Empty(t, w.Header().Get("X-Cache"))
+	assert.Equal(t, 4, calls)
+
+	send(http.MethodGet, "/cars?brand=missing", nil)
+	w = send(http.MethodGet, "/cars?brand=missing", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"), "only 200 responses are cached")
+
+	send(http.MethodGet, "/cars?brand=private", nil)
+	w = send(http.MethodGet, "/cars?brand=private", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"), "private responses are not cached")
+
+	evicted, err := cache.DeleteCacheIndex("cars")
+	assert.NoError(t, err)
+	assert.Equal(t, 3, evicted, "the cached keys and the index are deleted")
+	w = send(http.MethodGet, "/cars?brand=tesla", nil)
+	assert.Equal(t, "MISS", w.Header().Get("X-Cache"))
+}
+
+func TestInvalidateCache(t *testing.T) {
+	cache := caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})
+	route := CacheRoute{Route: "properties", AssetIDParam: "id", Related: []string{"owners"}}
+
+	seed := func() {
+		for _, key := range []struct{ index, key string }{
+			{"properties", "properties:limit=10"},
+			{"properties:1", "properties:1"},
+			{"properties:2", "properties:2"},
+			{"owners", "owners:5"},
+		} {
+			assert.NoError(t, cache.SetKey(key.key, "cached", nil))
+			assert.NoError(t, cache.SetKeyIndex(key.index, key.key))
+		}
+	}
+	cached := func(key string) bool {
+		_, err := cache.Get(key)
+		return err == nil
+	}
+
+	tests := []struct {
+		name        string
+		method      string
+		id          string
+		status      int
+		invalidated []string
+		kept        []string
+	}{
+		{name: "update asset", method: http.MethodPut, id: "1", status: http.StatusOK, invalidated: []string{"properties:limit=10", "properties:1", "owners:5"}, kept: []string{"properties:2"}},
+		{name: "create", method: http.MethodPost, status: http.StatusCreated, invalidated: []string{"properties:limit=10", "owners:5"}, kept: []string{"properties:1", "properties:2"}},
+		{name: "failed delete", method: http.MethodDelete, id: "1", status: http.StatusNotFound, kept: []string{"properties:limit=10", "properties:1", "owners:5"}},
+		{name: "read", method: http.MethodGet, id: "1", status: http.StatusOK, kept: []string{"properties:limit=10", "properties:1", "owners:5"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			seed()
+			handler := InvalidateCache(cache, route)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(tt.status)
+			}))
+			req := httptest.NewRequest(tt.method, "/properties", nil)
+			req.SetPathValue("id", tt.id)
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			for _, key := range tt.invalidated {
+				assert.False(t, cached(key), key)
+			}
+			for _, key := range tt.kept {
+				assert.True(t, cached(key), key)
+			}
+		})
+	}
+}
+
+func TestInvalidateRoute(t *testing.T) {
+	cache := caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})
+	assert.NoError(t, cache.SetKey("cars:1", "cached", nil))
+	assert.NoError(t, cache.SetKeyIndex("cars:1", "cars:1"))
+
+	req := httptest.NewRequest(http.MethodDelete, "/cars/1", nil)
+	req.SetPathValue("id", "1")
+	route := CacheRoute{Route: "cars", AssetIDParam: "id", Related: []string{"cars"}}
+	assert.Equal(t, []string{"cars:1", "cars"}, route.IndexKeys(req))
+
+	flushed, err := InvalidateRoute(cache, route, req)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, flushed)
+}
+
+func TestCacheResponsesPrivate(t *testing.T) {
+	tests := []struct {
+		name     string
+		route    CacheRoute
+		requests []map[string]string
+		expected []string
+	}{
+		{
+			name:     "authorization is not cached",
+			route:    CacheRoute{Route: "cars"},
+			requests: []map[string]string{{"Authorization": "Bearer a"}, {"Authorization": "Bearer a"}},
+			expected: []string{"", ""},
+		},
+		{
+			name:     "api key is not cached",
+			route:    CacheRoute{Route: "cars"},
+			requests: []map[string]string{{"X-API-Key": "a"}, {"X-API-Key": "a"}},
+			expected: []string{"", ""},
+		},
+		{
+			name:     "cookie is not cached",
+			route:    CacheRoute{Route: "cars"},
+			requests: []map[string]string{{"Cookie": "session=a"}, {"Cookie": "session=a"}},
+			expected: []string{"", ""},
+		},
+		{
+			name:     "api key param is not cached",
+			route:    CacheRoute{Route: "cars", PrivateParams: []string{"key"}},
+			requests: []map[string]string{{"query": "key=a"}, {"query": "key=a"}, {"query": "api_key=a"}, {"query": "api_key=a"}},
+			expected: []string{"", "", "MISS", "HIT"},
+		},
+		{
+			name: "empty key is not cached",
+			route: CacheRoute{Route: "cars", Key: func(r *http.Request) string {
+				return ""
+			}},
+			requests: []map[string]string{{"Authorization": "a"}, {"Authorization": "a"}},
+			expected: []string{"", ""},
+		},
+		{
+			name:     "custom private header",
+			route:    CacheRoute{Route: "cars", PrivateHeaders: []string{"X-Tenant"}},
+			requests: []map[string]string{{"X-Tenant": "a"}, {"Authorization": "Bearer a"}, {"Authorization": "Bearer a"}},
+			expected: []string{"", "MISS", "HIT"},
+		},
+		{
+			name: "key per caller",
+			route: CacheRoute{Route: "cars", Key: func(r *http.Request) string {
+				return "user=" + r.Header.Get("Authorization")
+			}},
+			requests: []map[string]string{{"Authorization": "a"}, {"Authorization": "b"}, {"Authorization": "a"}},
+			expected: []string{"MISS", "MISS", "HIT"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache := caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})
+			handler := CacheResponses(cache, tt.route)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(r.Header.Get("Authorization")))
+			}))
+			for i, headers := range tt.requests {
+				req := httptest.NewRequest(http.MethodGet, "/cars?"+headers["query"], nil)
+				for k, v := range headers {
+					if k != "query" {
+						req.Header.Set(k, v)
+					}
+				}
+				w := httptest.NewRecorder()
+				handler.ServeHTTP(w, req)
+				assert.Equal(t, tt.expected[i], w.Header().Get("X-Cache"), i)
+				assert.Equal(t, headers["Authorization"], w.Body.String(), i)
+			}
+		})
+	}
+}
+
+func TestInvalidateCacheBeforeResponse(t *testing.T) {
+	cache := caching.SetUpMemoryDB(&caching.CacheConfig{Prefix: "test"})
+	route := CacheRoute{Route: "properties"}
+	assert.NoError(t, cache.SetKey("properties:limit=10", "cached", nil))
+	assert.NoError(t, cache.SetKeyIndex("properties", "properties:limit=10"))
+
+	var cachedWhenSent bool
+	handler := InvalidateCache(cache, route)(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Write([]byte(`{"status":200}`))
+		_, err := cache.Get("properties:limit=10")
+		cachedWhenSent = err == nil
+	}))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/properties", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, cachedWhenSent, "the cache is invalidated before the body is written")
+}
@@ -0,0 +1,196 @@
+package dqk
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Role maps a role name to its permissions. Inherits lists the roles whose permissions are included.
+type Role struct {
+	Name        string   `json:"name" xml:"name" yaml:"name" csv:"name"`
+	Permissions []string `json:"permissions" xml:"permissions" yaml:"permissions" csv:"permissions"`
+	Inherits    []string `json:"inherits" xml:"inherits" yaml:"inherits" csv:"inherits"`
+}
+
+// RoleConfig is the JSON/YAML schema loaded by LoadRoles, YAML example:
+//
+//	roles:
+//	  - name: viewer
+//	    permissions: [view:articles]
+//	  - name: editor
+//	    permissions: [edit:articles]
+//	    inherits: [viewer]
+type RoleConfig struct {
+	Roles []Role `json:"roles" xml:"roles" yaml:"roles" csv:"roles"`
+}
+
+// RoleRegistry expands roles into permissions. It is safe for concurrent use.
+type RoleRegistry struct {
+	mu    sync.RWMutex
+	roles map[string]Role
+}
+
+// NewRoleRegistry returns a registry with the roles. It returns an error if a role inherits
+// an unknown role or the inheritance has a cycle.
+func NewRoleRegistry(roles ...Role) (*RoleRegistry, error) {
+	r := &RoleRegistry{roles: map[string]Role{}}
+	if err := r.Register(roles...); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// LoadRoles decodes a RoleConfig from JSON or YAML. format is "json" or "yaml" (or "yml")
+func LoadRoles(format string, data io.Reader) (*RoleRegistry, error) {
+	var config RoleConfig
+	switch strings.ToLower(strings.TrimPrefix(format, ".")) {
+	case "json":
+		if err := json.NewDecoder(data).Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding roles: %w", err)
+		}
+	case "yaml", "yml":
+		if err := yaml.NewDecoder(data).Decode(&config); err != nil {
+			return nil, fmt.Errorf("decoding roles: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported roles format %q", format)
+	}
+	return NewRoleRegistry(config.Roles...)
+}
+
+// LoadRolesFile loads a RoleConfig from a .json, .yaml or .yml file
+func LoadRolesFile(path string) (*RoleRegistry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return LoadRoles(filepath.Ext(path), file)
+}
+
+// Register adds or replaces roles. The roles are validated together with the registered ones,
+// on error nothing is registered.
+func (r *RoleRegistry) Register(roles ...Role) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	updated := make(map[string]Role, len(r.roles)+len(roles))
+	for name, role := range r.roles {
+		updated[name] = role
+	}
+	for _, role := range roles {
+		if role.Name == "" {
+			return fmt.Errorf("role with permissions %v has no name", role.Permissions)
+		}
+		updated[role.Name] = role
+	}
+	if err := validateRoles(updated); err != nil {
+		return err
+	}
+	r.roles = updated
+	return nil
+}
+
+// Role returns a registered role
+func (r *RoleRegistry) Role(name string) (Role, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	role, ok := r.roles[name]
+	return role, ok
+}
+
+// Permissions returns the sorted permissions of the roles, including the inherited ones.
+// Unknown roles are ignored.
+func (r *RoleRegistry) Permissions(roles ...string) []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := map[string]bool{}
+	set := map[string]bool{}
+	pending := slices.Clone(roles)
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		role, ok := r.roles[name]
+		if !ok || seen[name] {
+			continue
+		}
+		seen[name] = true
+		for _, permission := range role.Permissions {
+			set[permission] = true
+		}
+		pending = append(pending, role.Inherits...)
+	}
+
+	permissions := make([]string, 0, len(set))
+	for permission := range set {
+		permissions = append(permissions, permission)
+	}
+	slices.Sort(permissions)
+	return permissions
+}
+
+// PermissionsForRoles returns the flattened permission set of the roles, in the format of BuildPermissionSet
+//
+// Example:
+//
+//	perms := registry.PermissionsForRoles("editor")
+//	// → map[string]bool{"edit:articles": true, "view:articles": true}
+func (r *RoleRegistry) PermissionsForRoles(roles ...string) map[string]bool {
+	return BuildPermissionSet(r.Permissions(roles...))
+}
+
+// Matcher returns a PermissionMatcher for the roles, so their wildcards and denials are applied
+func (r *RoleRegistry) Matcher(implications map[string][]string, roles ...string) *PermissionMatcher {
+	return NewPermissionMatcher(r.Permissions(roles...), implications)
+}
+
+// validateRoles returns an error for unknown inherited roles and inheritance cycles
+func validateRoles(roles map[string]Role) error {
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := map[string]int{}
+
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		switch state[name] {
+		case visiting:
+			return fmt.Errorf("role inheritance cycle: %s", strings.Join(append(path, name), " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		for _, parent := range roles[name].Inherits {
+			if _, ok := roles[parent]; !ok {
+				return fmt.Errorf("role %q inherits unknown role %q", name, parent)
+			}
+			if err := visit(parent, append(path, name)); err != nil {
+				return err
+			}
+		}
+		state[name] = visited
+		return nil
+	}
+
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
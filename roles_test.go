@@ -0,0 +1,121 @@
+package dqk
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPermissionsForRoles(t *testing.T) {
+	registry, err := NewRoleRegistry(
+		Role{Name: "viewer", Permissions: []string{"view:articles"}},
+		Role{Name: "editor", Permissions: []string{"edit:articles"}, Inherits: []string{"viewer"}},
+		Role{Name: "moderator", Permissions: []string{"delete:comments"}, Inherits: []string{"viewer"}},
+		Role{Name: "admin", Permissions: []string{"*"}, Inherits: []string{"editor", "moderator"}},
+	)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		roles    []string
+		expected map[string]bool
+	}{
+		{name: "single role", roles: []string{"viewer"}, expected: map[string]bool{"view:articles": true}},
+		{name: "inherited", roles: []string{"editor"}, expected: map[string]bool{"view:articles": true, "edit:articles": true}},
+		{name: "multiple roles", roles: []string{"editor", "moderator"}, expected: map[string]bool{"view:articles": true, "edit:articles": true, "delete:comments": true}},
+		{name: "diamond", roles: []string{"admin"}, expected: map[string]bool{"*": true, "view:articles": true, "edit:articles": true, "delete:comments": true}},
+		{name: "unknown role", roles: []string{"guest"}, expected: map[string]bool{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, registry.PermissionsForRoles(tt.roles...))
+		})
+	}
+
+	assert.True(t, registry.Matcher(nil, "admin").HasPermission("delete:users"))
+}
+
+func TestRoleRegistryValidation(t *testing.T) {
+	tests := []struct {
+		name        string
+		roles       []Role
+		expectedErr string
+	}{
+		{
+			name:        "cycle",
+			roles:       []Role{{Name: "a", Inherits: []string{"b"}}, {Name: "b", Inherits: []string{"c"}}, {Name: "c", Inherits: []string{"a"}}},
+			expectedErr: "role inheritance cycle: a -> b -> c -> a",
+		},
+		{
+			name:        "self inheritance",
+			roles:       []Role{{Name: "a", Inherits: []string{"a"}}},
+			expectedErr: "role inheritance cycle: a -> a",
+		},
+		{
+			name:        "unknown parent",
+			roles:       []Role{{Name: "a", Inherits: []string{"b"}}},
+			expectedErr: `role "a" inherits unknown role "b"`,
+		},
+		{
+			name:        "no name",
+			roles:       []Role{{Permissions: []string{"view:users"}}},
+			expectedErr: "role with permissions [view:users] has no name",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewRoleRegistry(tt.roles...)
+			assert.EqualError(t, err, tt.expectedErr)
+		})
+	}
+
+	registry, err := NewRoleRegistry(Role{Name: "a"}, Role{Name: "b", Inherits: []string{"a"}})
+	assert.NoError(t, err)
+	assert.Error(t, registry.Register(Role{Name: "a", Inherits: []string{"b"}}))
+	role, _ := registry.Role("a")
+	assert.Empty(t, role.Inherits, "failed registration must not change the registry")
+}
+
+func TestLoadRoles(t *testing.T) {
+	tests := []struct {
+		name   string
+		format string
+		data   string
+	}{
+		{
+			name:   "json",
+			format: "json",
+			data:   `{"roles": [{"name": "viewer", "permissions": ["view:articles"]}, {"name": "editor", "permissions": ["edit:articles"], "inherits": ["viewer"]}]}`,
+		},
+		{
+			name:   "yaml",
+			format: ".yml",
+			data: `roles:
+  - name: viewer
+    permissions: [view:articles]
+  - name: editor
+    permissions: [edit:articles]
+    inherits: [viewer]
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry, err := LoadRoles(tt.format, strings.NewReader(tt.data))
+			assert.NoError(t, err)
+			assert.Equal(t, []string{"edit:articles", "view:articles"}, registry.Permissions("editor"))
+		})
+	}
+
+	_, err := LoadRoles("toml", strings.NewReader(""))
+	assert.Error(t, err)
+
+	path := filepath.Join(t.TempDir(), "roles.yaml")
+	assert.NoError(t, os.WriteFile(path, []byte(tests[1].data), 0o600))
+	registry, err := LoadRolesFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"view:articles": true}, registry.PermissionsForRoles("viewer"))
+}
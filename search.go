@@ -0,0 +1,193 @@
+package dqk
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+// SearchRequest is the schema for search endpoints (ie. POST /resource/search) where the filters
+// do not fit in a query string. It is decoded with DecodeBody, JSON example:
+//
+//	{
+//	  "filters": [{"name": "color", "values": ["red", "blue"]}],
+//	  "sort": [{"field": "price", "direction": "desc"}],
+//	  "fields": ["id", "name"],
+//	  "limit": 20,
+//	  "offset": 40
+//	}
+//
+// Query strings are converted to the same schema with NewSearchRequest, so both
+// endpoints compile to the same conditions through ApplySearch.
+type SearchRequest struct {
+	Filters []SearchFilter `json:"filters" xml:"filters>filter" yaml:"filters" csv:"filters"`
+	Sort    []SearchSort   `json:"sort" xml:"sort>field" yaml:"sort" csv:"sort"`
+	Fields  []string       `json:"fields" xml:"fields>field" yaml:"fields" csv:"fields"`
+	Limit   *int           `json:"limit" xml:"limit" yaml:"limit" csv:"limit"`
+	Offset  *int           `json:"offset" xml:"offset" yaml:"offset" csv:"offset"`
+}
+
+// SearchFilter is a filter name with its values. Name matches Filters.Name
+type SearchFilter struct {
+	Name   string   `json:"name" xml:"name,attr" yaml:"name" csv:"name"`
+	Values []string `json:"values" xml:"value" yaml:"values" csv:"values"`
+}
+
+// SearchSort is a field to order by. Field matches Filters.Name and Direction is ASC or DESC
+type SearchSort struct {
+	Field     string `json:"field" xml:"name,attr" yaml:"field" csv:"field"`
+	Direction string `json:"direction" xml:"direction,attr" yaml:"direction" csv:"direction"`
+}
+
+// NewSearchRequest converts query parameters to a SearchRequest.
+// sort is a comma separated list of fields, prefixed with - for descending order (ie. sort=-price,name)
+// and fields is a comma separated list of fields to select (ie. fields=id,name).
+// All other parameters except limit and offset are kept as filters.
+func NewSearchRequest(params map[string][]string) SearchRequest {
+	s := SearchRequest{}
+	for key, values := range params {
+		switch strings.ToLower(key) {
+		case TokenLimit:
+			s.Limit = firstInt(values)
+		case TokenOffset:
+			s.Offset = firstInt(values)
+		case TokenSort:
+			for _, field := range splitValues(values) {
+				if after, ok := strings.CutPrefix(field, "-"); ok {
+					s.Sort = append(s.Sort, SearchSort{Field: after, Direction: "DESC"})
+					continue
+				}
+				s.Sort = append(s.Sort, SearchSort{Field: field, Direction: "ASC"})
+			}
+		case TokenFields:
+			s.Fields = append(s.Fields, splitValues(values)...)
+		default:
+			s.Filters = append(s.Filters, SearchFilter{Name: key, Values: values})
+		}
+	}
+	return s
+}
+
+// DecodeSearchRequest decodes a SearchRequest from a request body using DecodeBody
+func DecodeSearchRequest(contentType string, body io.Reader) (SearchRequest, int, error) {
+	var s SearchRequest
+	status, err := DecodeBody(contentType, body, &s)
+	return s, status, err
+}
+
+// Params returns the search filters, limit & offset in the query parameter format expected by DynamicFilters.
+// The values are copied since DynamicFilters modifies them.
+func (s SearchRequest) Params() map[string][]string {
+	params := make(map[string][]string, len(s.Filters)+2)
+	for _, filter := range s.Filters {
+		params[filter.Name] = append(params[filter.Name], filter.Values...)
+	}
+	if s.Limit != nil {
+		params[TokenLimit] = []string{strconv.Itoa(*s.Limit)}
+	}
+	if s.Offset != nil {
+		params[TokenOffset] = []string{strconv.Itoa(*s.Offset)}
+	}
+	return params
+}
+
+// SelectFields returns the columns for the requested fields as "DbField AS Name".
+// Fields that do not match a filter name, or match a filter the user is not permitted to use
+// (see PermittedFilters), are ignored.
+// Expression filters with bind parameters are only supported through ApplySearch.
+func SelectFields(filters []Filters, fields []string) []string {
+	columns := []string{}
+	selected := map[string]bool{}
+	for _, field := range fields {
+		for _, filter := range filters {
+			if filter.restricted || !strings.EqualFold(filter.Name, strings.TrimSpace(field)) || selected[filter.Name] {
+				continue
+			}
+			selected[filter.Name] = true
+			columns = append(columns, fmt.Sprintf("%s AS %s", filter.columnSQL(), filter.Name))
+		}
+	}
+	return columns
+}
+
+// ApplySearch applies the search to the query: the selected fields replace the query columns,
+// the filters are applied with DynamicFilters and the query is ordered by the valid sort fields.
+// Expression filters keep their bind parameters when they are selected or sorted on.
+func ApplySearch(filters []Filters, q sq.SelectBuilder, s SearchRequest) sq.SelectBuilder {
+	return ApplySearchQualify(filters, q, s, QualifyConfig{})
+}
+
+// ApplySearchQualify works like ApplySearch with the QualifyConfig of DynamicFiltersQualify.
+// The selected fields are the result columns when config.Columns is empty and the sort of the
+// request is used as config.OrderBy
+func ApplySearchQualify(filters []Filters, q sq.SelectBuilder, s SearchRequest, config QualifyConfig) sq.SelectBuilder {
+	columns, names := selectColumns(filters, s.Fields)
+	if len(columns) > 0 {
+		q = q.RemoveColumns()
+		for _, column := range columns {
+			q = q.Column(column)
+		}
+		if len(config.Columns) == 0 {
+			config.Columns = names
+		}
+	}
+
+	config.OrderBy = nil
+	for _, sort := range s.Sort {
+		if ok, filter := IsFieldFilter(filters, sort.Field); !ok || filter.restricted {
+			continue
+		}
+		config.OrderBy = append(config.OrderBy, sort)
+	}
+
+	return DynamicFiltersQualify(filters, q, s.Params(), config)
+}
+
+// selectColumns works like SelectFields but returns the columns as expressions with their arguments
+// and the names of the selected filters
+func selectColumns(filters []Filters, fields []string) ([]sq.Sqlizer, []string) {
+	columns := []sq.Sqlizer{}
+	names := []string{}
+	selected := map[string]bool{}
+	for _, field := range fields {
+		for _, filter := range filters {
+			if filter.restricted || !strings.EqualFold(filter.Name, strings.TrimSpace(field)) || selected[filter.Name] {
+				continue
+			}
+			column, err := filter.ColumnExpr()
+			if err != nil {
+				continue
+			}
+			selected[filter.Name] = true
+			columns = append(columns, sq.Alias(column, filter.Name))
+			names = append(names, filter.Name)
+		}
+	}
+	return columns, names
+}
+
+func firstInt(values []string) *int {
+	if len(values) == 0 {
+		return nil
+	}
+	value, err := strconv.Atoi(values[0])
+	if err != nil {
+		return nil
+	}
+	return &value
+}
+
+func splitValues(values []string) []string {
+	split := []string{}
+	for _, value := range values {
+		for _, part := range strings.Split(value, ",") {
+			if part = strings.TrimSpace(part); part != "" {
+				split = append(split, part)
+			}
+		}
+	}
+	return split
+}
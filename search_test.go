@@ -0,0 +1,160 @@
+package dqk
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewSearchRequest(t *testing.T) {
+	limit, offset := 20, 40
+	params := map[string][]string{
+		"color":  {"red", "blue"},
+		"limit":  {"20"},
+		"OFFSET": {"40"},
+		"sort":   {"-price,name"},
+		"fields": {"id,name", "price"},
+	}
+
+	got := NewSearchRequest(params)
+	assert.Equal(t, SearchRequest{
+		Filters: []SearchFilter{{Name: "color", Values: []string{"red", "blue"}}},
+		Sort:    []SearchSort{{Field: "price", Direction: "DESC"}, {Field: "name", Direction: "ASC"}},
+		Fields:  []string{"id", "name", "price"},
+		Limit:   &limit,
+		Offset:  &offset,
+	}, got)
+
+	assert.Equal(t, map[string][]string{
+		"color":  {"red", "blue"},
+		"limit":  {"20"},
+		"offset": {"40"},
+	}, got.Params())
+}
+
+func TestDecodeSearchRequest(t *testing.T) {
+	limit := 5
+	expected := SearchRequest{
+		Filters: []SearchFilter{{Name: "color", Values: []string{"red", "blue"}}},
+		Sort:    []SearchSort{{Field: "price", Direction: "desc"}},
+		Fields:  []string{"id", "name"},
+		Limit:   &limit,
+	}
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		expectErr   bool
+	}{
+		{
+			name:        "json",
+			contentType: "application/json",
+			body:        `{"filters":[{"name":"color","values":["red","blue"]}],"sort":[{"field":"price","direction":"desc"}],"fields":["id","name"],"limit":5}`,
+			status:      http.StatusOK,
+		},
+		{
+			name:        "xml",
+			contentType: "application/xml",
+			body:        `<search><filters><filter name="color"><value>red</value><value>blue</value></filter></filters><sort><field name="price" direction="desc"></field></sort><fields><field>id</field><field>name</field></fields><limit>5</limit></search>`,
+			status:      http.StatusOK,
+		},
+		{
+			name:        "unknown field",
+			contentType: "application/json",
+			body:        `{"filter":[]}`,
+			status:      http.StatusBadRequest,
+			expectErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, status, err := DecodeSearchRequest(tt.contentType, strings.NewReader(tt.body))
+			assert.Equal(t, tt.status, status)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, expected, got)
+		})
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	filters := []Filters{
+		{Name: "id", Operator: "=", DbField: "cars.id"},
+		{Name: "name", Operator: "LIKE", DbField: "cars.name"},
+	}
+	got := SelectFields(filters, []string{"Name", "id", "unknown", "name"})
+	assert.Equal(t, []string{"cars.name AS name", "cars.id AS id"}, got)
+}
+
+func TestApplySearchMatchesQueryString(t *testing.T) {
+	filters := []Filters{
+		{Name: "id", Operator: "=", DbField: "cars.id"},
+		{Name: "name", Operator: "LIKE", DbField: "cars.name"},
+		{Name: "color", Operator: "IN", DbField: "colors.name"},
+		{Name: "price", Operator: ">", DbField: "cars.price"},
+	}
+
+	queryString := map[string][]string{
+		"color":  {"red", "blue"},
+		"name":   {"model"},
+		"sort":   {"-price"},
+		"fields": {"id,name"},
+		"limit":  {"10"},
+	}
+	limit := 10
+	body := SearchRequest{
+		Filters: []SearchFilter{
+			{Name: "color", Values: []string{"red", "blue"}},
+			{Name: "name", Values: []string{"model"}},
+		},
+		Sort:   []SearchSort{{Field: "price", Direction: "DESC"}},
+		Fields: []string{"id", "name"},
+		Limit:  &limit,
+	}
+
+	fromQuery := NewSearchRequest(queryString)
+	assert.ElementsMatch(t, BuildFilterConditions(filters, fromQuery.Params()), BuildFilterConditions(filters, body.Params()))
+
+	q := sq.Select("*").From("cars").Join("colors ON colors.id = cars.color_id")
+	single := SearchRequest{Filters: body.Filters[:1], Sort: body.Sort, Fields: body.Fields, Limit: body.Limit}
+	sql, args, err := ApplySearch(filters, q, single).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT (cars.id) AS id, (cars.name) AS name FROM cars JOIN colors ON colors.id = cars.color_id WHERE colors.name IN (?,?) ORDER BY cars.price DESC LIMIT 10", sql)
+	assert.Equal(t, []any{"red", "blue"}, args)
+}
+
+func TestApplySearchQualify(t *testing.T) {
+	filters := []Filters{
+		{Name: "id", Operator: "=", DbField: "cars.id"},
+		{Name: "price", Operator: ">", DbField: "cars.price"},
+		{Name: "rank", Operator: "<=", DbField: "ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price)"},
+	}
+	search := SearchRequest{
+		Filters: []SearchFilter{{Name: "rank", Values: []string{"3"}}},
+		Sort:    []SearchSort{{Field: "price", Direction: "DESC"}},
+		Fields:  []string{"id"},
+	}
+
+	sql, args, err := ApplySearch(filters, sq.Select("*").From("cars"), search).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT qualified.id FROM (SELECT (cars.id) AS id, ((ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price) <= ?)) AS dqk_qualify, (cars.price) AS dqk_qualify_order_0 FROM cars) AS qualified WHERE qualified.dqk_qualify ORDER BY qualified.dqk_qualify_order_0 DESC", sql)
+	assert.Equal(t, []any{"3"}, args)
+
+	search.Fields = nil
+	_, _, err = ApplySearch(filters, sq.Select("*").From("cars"), search).ToSql()
+	assert.Error(t, err, "the result columns of * can not be named")
+
+	psql := sq.StatementBuilder.PlaceholderFormat(sq.Dollar)
+	config := QualifyConfig{Columns: []string{"id", "price"}, Builder: &psql}
+	sql, _, err = ApplySearchQualify(filters, psql.Select("cars.id", "cars.price").From("cars"), search, config).ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT qualified.id, qualified.price FROM (SELECT cars.id, cars.price, ((ROW_NUMBER() OVER (PARTITION BY cars.brand ORDER BY cars.price) <= $1)) AS dqk_qualify, (cars.price) AS dqk_qualify_order_0 FROM cars) AS qualified WHERE qualified.dqk_qualify ORDER BY qualified.dqk_qualify_order_0 DESC", sql)
+}
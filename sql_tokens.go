@@ -0,0 +1,126 @@
+package dqk
+
+import (
+	"strings"
+	"unicode"
+)
+
+const (
+	sqlIdent = iota
+	sqlQuotedIdent
+	sqlString
+	sqlNumber
+	sqlPlaceholder
+	sqlPunct
+)
+
+type sqlToken struct {
+	kind  int
+	value string
+}
+
+type sqlTokens []sqlToken
+
+// tokenizeSQL splits an SQL expression into tokens. It is not a full SQL lexer,
+// it is only precise enough to find function calls, keywords and placeholders
+// while skipping string literals, quoted identifiers and comments.
+func tokenizeSQL(expr string) sqlTokens {
+	var tokens sqlTokens
+	runes := []rune(expr)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			i += 2
+			for i < len(runes) && (runes[i] != '*' || i+1 >= len(runes) || runes[i+1] != '/') {
+				i++
+			}
+			i += 2
+
+		case r == '\'' || r == '"' || r == '`':
+			start := i
+			i++
+			for i < len(runes) {
+				if runes[i] == r {
+					// doubled quotes are escaped quotes
+					if i+1 < len(runes) && runes[i+1] == r {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			kind := sqlQuotedIdent
+			if r == '\'' {
+				kind = sqlString
+			}
+			end := min(i+1, len(runes))
+			tokens = append(tokens, sqlToken{kind: kind, value: string(runes[start:end])})
+			i = end
+
+		case r == '_' || unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (runes[i] == '_' || runes[i] == '$' || unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlIdent, value: string(runes[start:i])})
+
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && (runes[i] == '.' || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			tokens = append(tokens, sqlToken{kind: sqlNumber, value: string(runes[start:i])})
+
+		case r == '?':
+			// ?? is the squirrel escape for a literal question mark
+			if i+1 < len(runes) && runes[i+1] == '?' {
+				tokens = append(tokens, sqlToken{kind: sqlPunct, value: "??"})
+				i += 2
+				continue
+			}
+			tokens = append(tokens, sqlToken{kind: sqlPlaceholder, value: "?"})
+			i++
+
+		default:
+			tokens = append(tokens, sqlToken{kind: sqlPunct, value: string(r)})
+			i++
+		}
+	}
+	return tokens
+}
+
+func (t sqlTokens) isPunct(i int, value string) bool {
+	return i >= 0 && i < len(t) && t[i].kind == sqlPunct && t[i].value == value
+}
+
+func (t sqlTokens) isKeyword(i int, keyword string) bool {
+	return i >= 0 && i < len(t) && t[i].kind == sqlIdent && strings.EqualFold(t[i].value, keyword)
+}
+
+// closingParen returns the index of the parenthesis closing the one at index open
+func (t sqlTokens) closingParen(open int) int {
+	depth := 0
+	for i := open; i < len(t); i++ {
+		switch {
+		case t.isPunct(i, "("):
+			depth++
+		case t.isPunct(i, ")"):
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(t) - 1
+}
@@ -0,0 +1,237 @@
+package dqk
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+)
+
+const (
+	BucketHour  = "hour"
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// TimeBucket describes the bucketing requested with the bucket & tz query parameters.
+// Weeks start on Monday for every dialect.
+type TimeBucket struct {
+	Interval string
+	Location *time.Location
+}
+
+// ParseTimeBucket reads the bucket and tz parameters.
+// It returns nil when no bucket was requested. The timezone defaults to UTC.
+func ParseTimeBucket(params map[string][]string) (*TimeBucket, error) {
+	var interval, tz string
+	for k, v := range params {
+		if len(v) == 0 {
+			continue
+		}
+		switch strings.ToLower(k) {
+		case TokenBucket:
+			interval = strings.ToLower(strings.TrimSpace(v[0]))
+		case TokenTZ:
+			tz = strings.TrimSpace(v[0])
+		}
+	}
+
+	if interval == "" {
+		return nil, nil
+	}
+
+	if !isBucketInterval(interval) {
+		return nil, fmt.Errorf("unsupported bucket %q", interval)
+	}
+
+	location := time.UTC
+	if tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("unsupported timezone %q", tz)
+		}
+		location = loc
+	}
+
+	return &TimeBucket{Interval: interval, Location: location}, nil
+}
+
+// BucketExpression returns the expression that truncates column to the bucket for the given dialect.
+// Timestamps are expected to be stored in UTC (timestamptz for postgres).
+//
+//   - postgres: date_trunc('day', column AT TIME ZONE ?) AT TIME ZONE ?, the local bucket start is
+//     converted back to a timestamptz so drivers scan it as the right instant
+//   - mysql: DATE_FORMAT(CONVERT_TZ(column, '+00:00', ?), '%Y-%m-%d'), requires the timezone tables to be loaded
+//   - sqlite: strftime('%Y-%m-%d', column, ?), sqlite has no timezone database so the offset of
+//     the location is applied as a fixed modifier. Locations with daylight saving time are rejected
+func BucketExpression(dialect Dialect, column string, b TimeBucket) (sq.Sqlizer, error) {
+	if !isBucketInterval(b.Interval) {
+		return nil, fmt.Errorf("unsupported bucket %q", b.Interval)
+	}
+	location := b.location()
+
+	switch dialect {
+	case DialectPostgres:
+		return sq.Expr(fmt.Sprintf("date_trunc('%s', %s AT TIME ZONE ?) AT TIME ZONE ?", b.Interval, column), location.String(), location.String()), nil
+
+	case DialectMySQL:
+		local := fmt.Sprintf("CONVERT_TZ(%s, '+00:00', ?)", column)
+		switch b.Interval {
+		case BucketHour:
+			return sq.Expr(fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d %%H:00:00')", local), location.String()), nil
+		case BucketDay:
+			return sq.Expr(fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-%%d')", local), location.String()), nil
+		case BucketWeek:
+			return sq.Expr(fmt.Sprintf("DATE_FORMAT(DATE_SUB(%s, INTERVAL WEEKDAY(%s) DAY), '%%Y-%%m-%%d')", local, local), location.String(), location.String()), nil
+		case BucketMonth:
+			return sq.Expr(fmt.Sprintf("DATE_FORMAT(%s, '%%Y-%%m-01')", local), location.String()), nil
+		}
+
+	case DialectSQLite:
+		offset, ok := fixedOffset(location)
+		if !ok {
+			return nil, fmt.Errorf("timezone %q has daylight saving time, sqlite supports fixed offsets only", location)
+		}
+		modifier := fmt.Sprintf("%+d minutes", offset/60)
+		switch b.Interval {
+		case BucketHour:
+			return sq.Expr(fmt.Sprintf("strftime('%%Y-%%m-%%d %%H:00:00', %s, ?)", column), modifier), nil
+		case BucketDay:
+			return sq.Expr(fmt.Sprintf("strftime('%%Y-%%m-%%d', %s, ?)", column), modifier), nil
+		case BucketWeek:
+			return sq.Expr(fmt.Sprintf("strftime('%%Y-%%m-%%d', %s, ?, 'weekday 0', '-6 days')", column), modifier), nil
+		case BucketMonth:
+			return sq.Expr(fmt.Sprintf("strftime('%%Y-%%m-01', %s, ?)", column), modifier), nil
+		}
+
+	default:
+		return nil, fmt.Errorf("time bucketing is not supported for dialect %q", dialect)
+	}
+
+	return nil, fmt.Errorf("unsupported bucket %q", b.Interval)
+}
+
+// ApplyTimeBucket adds the bucket column to the query, grouped and ordered by it.
+// The bucket is computed on the DbField of the filter with Kind KindTimestamp, using that filter's Dialect.
+// When no bucket parameter is provided the query is returned as is and the TimeBucket is nil.
+// The returned TimeBucket can be used with FillBuckets to add the empty buckets to the result.
+func ApplyTimeBucket(filters []Filters, q sq.SelectBuilder, params map[string][]string) (sq.SelectBuilder, *TimeBucket, error) {
+	bucket, err := ParseTimeBucket(params)
+	if err != nil || bucket == nil {
+		return q, nil, err
+	}
+
+	for _, filter := range filters {
+		if filter.Kind != KindTimestamp {
+			continue
+		}
+		expr, err := BucketExpression(filter.Dialect, filter.DbField, *bucket)
+		if err != nil {
+			return q, nil, err
+		}
+		q = q.Column(sq.Alias(expr, TokenBucket)).GroupBy(TokenBucket).OrderBy(TokenBucket)
+		return q, bucket, nil
+	}
+
+	return q, nil, fmt.Errorf("no timestamp filter declared for bucketing")
+}
+
+// Truncate returns the start of the bucket t belongs to, in the bucket location
+func (b TimeBucket) Truncate(t time.Time) time.Time {
+	t = t.In(b.location())
+	switch b.Interval {
+	case BucketHour:
+		// truncated in absolute time, the local hours repeated when the clocks go back are different buckets
+		_, offset := t.Zone()
+		shift := time.Duration(offset) * time.Second
+		return t.Add(shift).Truncate(time.Hour).Add(-shift)
+	case BucketWeek:
+		daysSinceMonday := (int(t.Weekday()) + 6) % 7
+		return time.Date(t.Year(), t.Month(), t.Day()-daysSinceMonday, 0, 0, 0, 0, t.Location())
+	case BucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	default:
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	}
+}
+
+// Next returns the start of the bucket following the one t belongs to
+func (b TimeBucket) Next(t time.Time) time.Time {
+	start := b.Truncate(t)
+	switch b.Interval {
+	case BucketHour:
+		return start.Add(time.Hour)
+	case BucketWeek:
+		return start.AddDate(0, 0, 7)
+	case BucketMonth:
+		return start.AddDate(0, 1, 0)
+	default:
+		return start.AddDate(0, 0, 1)
+	}
+}
+
+// Parse parses a bucket returned as text by mysql or sqlite in the bucket location
+func (b TimeBucket) Parse(value string) (time.Time, error) {
+	layout := time.DateOnly
+	if len(value) > len(time.DateOnly) {
+		layout = time.DateTime
+	}
+	return time.ParseInLocation(layout, value, b.location())
+}
+
+func isBucketInterval(interval string) bool {
+	switch interval {
+	case BucketHour, BucketDay, BucketWeek, BucketMonth:
+		return true
+	}
+	return false
+}
+
+// fixedOffset returns the offset of the location when it is the same all year round
+func fixedOffset(location *time.Location) (int, bool) {
+	year := time.Now().Year()
+	_, winter := time.Date(year, time.January, 1, 0, 0, 0, 0, location).Zone()
+	_, summer := time.Date(year, time.July, 1, 0, 0, 0, 0, location).Zone()
+	return winter, winter == summer
+}
+
+func (b TimeBucket) location() *time.Location {
+	if b.Location == nil {
+		return time.UTC
+	}
+	return b.Location
+}
+
+// FillBuckets returns a point for every bucket between from and to (both included).
+// Points are matched to buckets with bucketOf, missing buckets are created with empty.
+// When from or to are zero the first and last point are used instead.
+// points are expected to be ordered by bucket, as returned by ApplyTimeBucket.
+func FillBuckets[T any](b TimeBucket, from, to time.Time, points []T, bucketOf func(T) time.Time, empty func(time.Time) T) []T {
+	if len(points) == 0 && (from.IsZero() || to.IsZero()) {
+		return points
+	}
+	if from.IsZero() {
+		from = bucketOf(points[0])
+	}
+	if to.IsZero() {
+		to = bucketOf(points[len(points)-1])
+	}
+
+	existing := make(map[int64]T, len(points))
+	for _, point := range points {
+		existing[b.Truncate(bucketOf(point)).Unix()] = point
+	}
+
+	filled := []T{}
+	end := b.Truncate(to)
+	for current := b.Truncate(from); !current.After(end); current = b.Next(current) {
+		if point, ok := existing[current.Unix()]; ok {
+			filled = append(filled, point)
+			continue
+		}
+		filled = append(filled, empty(current))
+	}
+	return filled
+}
@@ -0,0 +1,242 @@
+package dqk
+
+import (
+	"testing"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseTimeBucket(t *testing.T) {
+	athens, _ := time.LoadLocation("Europe/Athens")
+	tests := []struct {
+		name      string
+		params    map[string][]string
+		expected  *TimeBucket
+		expectErr bool
+	}{
+		{
+			name:     "no bucket",
+			params:   map[string][]string{"color": {"red"}},
+			expected: nil,
+		},
+		{
+			name:     "default timezone",
+			params:   map[string][]string{"bucket": {"Day"}},
+			expected: &TimeBucket{Interval: BucketDay, Location: time.UTC},
+		},
+		{
+			name:     "with timezone",
+			params:   map[string][]string{"BUCKET": {"week"}, "tz": {"Europe/Athens"}},
+			expected: &TimeBucket{Interval: BucketWeek, Location: athens},
+		},
+		{
+			name:      "unsupported bucket",
+			params:    map[string][]string{"bucket": {"decade"}},
+			expectErr: true,
+		},
+		{
+			name:      "unsupported timezone",
+			params:    map[string][]string{"bucket": {"day"}, "tz": {"Mars/Olympus"}},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseTimeBucket(tt.params)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expected, got)
+		})
+	}
+}
+
+func TestBucketExpression(t *testing.T) {
+	athens, _ := time.LoadLocation("Europe/Athens")
+	tests := []struct {
+		name         string
+		dialect      Dialect
+		bucket       TimeBucket
+		expectedSQL  string
+		expectedArgs []any
+		expectErr    bool
+	}{
+		{
+			name:         "postgres day",
+			dialect:      DialectPostgres,
+			bucket:       TimeBucket{Interval: BucketDay, Location: time.UTC},
+			expectedSQL:  "date_trunc('day', orders.created_at AT TIME ZONE ?) AT TIME ZONE ?",
+			expectedArgs: []any{"UTC", "UTC"},
+		},
+		{
+			name:         "mysql month",
+			dialect:      DialectMySQL,
+			bucket:       TimeBucket{Interval: BucketMonth},
+			expectedSQL:  "DATE_FORMAT(CONVERT_TZ(orders.created_at, '+00:00', ?), '%Y-%m-01')",
+			expectedArgs: []any{"UTC"},
+		},
+		{
+			name:         "mysql week",
+			dialect:      DialectMySQL,
+			bucket:       TimeBucket{Interval: BucketWeek},
+			expectedSQL:  "DATE_FORMAT(DATE_SUB(CONVERT_TZ(orders.created_at, '+00:00', ?), INTERVAL WEEKDAY(CONVERT_TZ(orders.created_at, '+00:00', ?)) DAY), '%Y-%m-%d')",
+			expectedArgs: []any{"UTC", "UTC"},
+		},
+		{
+			name:         "sqlite hour",
+			dialect:      DialectSQLite,
+			bucket:       TimeBucket{Interval: BucketHour, Location: time.FixedZone("UTC+2", 2*60*60)},
+			expectedSQL:  "strftime('%Y-%m-%d %H:00:00', orders.created_at, ?)",
+			expectedArgs: []any{"+120 minutes"},
+		},
+		{
+			name:         "sqlite week",
+			dialect:      DialectSQLite,
+			bucket:       TimeBucket{Interval: BucketWeek},
+			expectedSQL:  "strftime('%Y-%m-%d', orders.created_at, ?, 'weekday 0', '-6 days')",
+			expectedArgs: []any{"+0 minutes"},
+		},
+		{
+			name:      "sqlite daylight saving time",
+			dialect:   DialectSQLite,
+			bucket:    TimeBucket{Interval: BucketDay, Location: athens},
+			expectErr: true,
+		},
+		{
+			name:      "unsupported dialect",
+			dialect:   Dialect("oracle"),
+			bucket:    TimeBucket{Interval: BucketDay},
+			expectErr: true,
+		},
+		{
+			name:      "unsupported interval",
+			dialect:   DialectPostgres,
+			bucket:    TimeBucket{Interval: "day'); DROP TABLE orders; --"},
+			expectErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expr, err := BucketExpression(tt.dialect, "orders.created_at", tt.bucket)
+			if tt.expectErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			sql, args, err := expr.ToSql()
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedSQL, sql)
+			assert.Equal(t, tt.expectedArgs, args)
+		})
+	}
+}
+
+func TestApplyTimeBucket(t *testing.T) {
+	filters := []Filters{
+		{Name: "status", Operator: "=", DbField: "orders.status"},
+		{Name: "created_at", Operator: ">=", DbField: "orders.created_at", Kind: KindTimestamp, Dialect: DialectPostgres},
+	}
+
+	q := sq.Select("COUNT(*) AS total").From("orders")
+	query, bucket, err := ApplyTimeBucket(filters, q, map[string][]string{"bucket": {"day"}, "tz": {"UTC"}})
+	assert.NoError(t, err)
+	assert.Equal(t, &TimeBucket{Interval: BucketDay, Location: time.UTC}, bucket)
+
+	sql, args, err := query.ToSql()
+	assert.NoError(t, err)
+	assert.Equal(t, "SELECT COUNT(*) AS total, (date_trunc('day', orders.created_at AT TIME ZONE ?) AT TIME ZONE ?) AS bucket FROM orders GROUP BY bucket ORDER BY bucket", sql)
+	assert.Equal(t, []any{"UTC", "UTC"}, args)
+
+	query, bucket, err = ApplyTimeBucket(filters, q, map[string][]string{})
+	assert.NoError(t, err)
+	assert.Nil(t, bucket)
+	assert.Equal(t, q, query)
+
+	_, _, err = ApplyTimeBucket(filters[:1], q, map[string][]string{"bucket": {"day"}})
+	assert.Error(t, err)
+}
+
+func TestTimeBucketTruncate(t *testing.T) {
+	athens, _ := time.LoadLocation("Europe/Athens")
+	// 2025-03-05 is a Wednesday. 23:30 UTC is already the 6th in Athens
+	ts := time.Date(2025, 3, 5, 23, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		bucket   TimeBucket
+		expected time.Time
+	}{
+		{name: "hour", bucket: TimeBucket{Interval: BucketHour}, expected: time.Date(2025, 3, 5, 23, 0, 0, 0, time.UTC)},
+		{name: "day", bucket: TimeBucket{Interval: BucketDay}, expected: time.Date(2025, 3, 5, 0, 0, 0, 0, time.UTC)},
+		{name: "week", bucket: TimeBucket{Interval: BucketWeek}, expected: time.Date(2025, 3, 3, 0, 0, 0, 0, time.UTC)},
+		{name: "month", bucket: TimeBucket{Interval: BucketMonth}, expected: time.Date(2025, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{name: "day in timezone", bucket: TimeBucket{Interval: BucketDay, Location: athens}, expected: time.Date(2025, 3, 6, 0, 0, 0, 0, athens)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.True(t, tt.expected.Equal(tt.bucket.Truncate(ts)), "got %s", tt.bucket.Truncate(ts))
+		})
+	}
+}
+
+func TestFillBuckets(t *testing.T) {
+	type point struct {
+		Bucket time.Time
+		Total  int
+	}
+	b := TimeBucket{Interval: BucketDay, Location: time.UTC}
+	day := func(d int) time.Time { return time.Date(2025, 1, d, 0, 0, 0, 0, time.UTC) }
+
+	points := []point{{Bucket: day(2), Total: 4}, {Bucket: day(5), Total: 1}}
+	bucketOf := func(p point) time.Time { return p.Bucket }
+	empty := func(t time.Time) point { return point{Bucket: t} }
+
+	filled := FillBuckets(b, day(1), day(6), points, bucketOf, empty)
+	assert.Equal(t, []point{
+		{Bucket: day(1)},
+		{Bucket: day(2), Total: 4},
+		{Bucket: day(3)},
+		{Bucket: day(4)},
+		{Bucket: day(5), Total: 1},
+		{Bucket: day(6)},
+	}, filled)
+
+	filled = FillBuckets(b, time.Time{}, time.Time{}, points, bucketOf, empty)
+	assert.Len(t, filled, 4)
+
+	parsed, err := b.Parse("2025-01-03")
+	assert.NoError(t, err)
+	assert.True(t, day(3).Equal(parsed))
+}
+
+func TestFillBucketsDaylightSaving(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	assert.NoError(t, err)
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	assert.NoError(t, err)
+	b := TimeBucket{Interval: BucketHour, Location: newYork}
+	utc := func(day, hour int) time.Time { return time.Date(2026, time.November, day, hour, 0, 0, 0, time.UTC) }
+
+	// the clocks go back at 02:00 EDT (06:00 UTC) on 2026-11-01, 01:00 local happens twice
+	from := time.Date(2026, time.November, 1, 0, 0, 0, 0, newYork)
+	to := time.Date(2026, time.November, 1, 3, 0, 0, 0, newYork)
+	filled := FillBuckets(b, from, to, []time.Time{}, func(t time.Time) time.Time { return t }, func(t time.Time) time.Time { return t })
+	assert.Len(t, filled, 5)
+	for i, bucket := range filled {
+		assert.True(t, utc(1, 4+i).Equal(bucket), bucket)
+	}
+	assert.True(t, utc(1, 6).Equal(b.Truncate(utc(1, 6).Add(30*time.Minute))), "01:30 EST belongs to 01:00 EST")
+
+	// the clocks go forward at 02:00 EST on 2026-03-08, 02:00 local is skipped
+	from = time.Date(2026, time.March, 8, 0, 0, 0, 0, newYork)
+	to = time.Date(2026, time.March, 8, 3, 0, 0, 0, newYork)
+	filled = FillBuckets(b, from, to, []time.Time{}, func(t time.Time) time.Time { return t }, func(t time.Time) time.Time { return t })
+	assert.Len(t, filled, 3)
+
+	half := TimeBucket{Interval: BucketHour, Location: kolkata}
+	assert.Equal(t, time.Date(2026, time.January, 1, 10, 0, 0, 0, kolkata), half.Truncate(time.Date(2026, time.January, 1, 10, 45, 0, 0, kolkata)))
+}
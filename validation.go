@@ -7,6 +7,8 @@ import (
 	"net/http"
 	"reflect"
 	"strings"
+
+	sq "github.com/Masterminds/squirrel"
 )
 
 // IsFieldJSONTag checks if the string provided matches any json tag of a struct
@@ -40,6 +42,8 @@ func IsFieldFilter(filters []Filters, field string) (bool, Filters) {
 }
 
 // OrderValidation provide a struct, the order by string and d.irection and default order by string
+// Expression filters with bind parameters are ordered by their DbField (or skipped when they have none),
+// use OrderExpression to keep them
 func OrderValidation(orderByStr string, orderDirectionStr string, filters []Filters) string {
 	method := "OrderValidation"
 	orderBy := strings.ToLower(orderByStr)
@@ -53,18 +57,67 @@ func OrderValidation(orderByStr string, orderDirectionStr string, filters []Filt
 	result, filter := IsFieldFilter(filters, orderBy)
 	if !result || orderBy == "" {
 		slog.LogAttrs(context.Background(), slog.LevelWarn, "order by that does not exist as a filter was provided, using first field instead", slog.String("order by", orderBy), slog.String("order direction", orderDirection), slog.String("filter", filters[0].DbField))
-		orderBy = filters[0].DbField
-	} else {
-		orderBy = filter.DbField
+		filter = filters[0]
+	}
+	orderBy = filter.orderSQL()
+	for i := 0; orderBy == "" && i < len(filters); i++ {
+		orderBy = filters[i].orderSQL()
 	}
 	return fmt.Sprintf("%s %s", orderBy, orderDirection)
 }
 
+// orderSQL returns the column OrderValidation orders by. Expressions with bind parameters can not
+// be ordered by without their arguments, the DbField is used instead
+func (f *Filters) orderSQL() string {
+	if f.Expression == nil {
+		return f.DbField
+	}
+	sql, args, open, err := f.Expression.toSql()
+	if err != nil || len(args) > 0 || open > 0 {
+		slog.LogAttrs(context.Background(), slog.LevelWarn, "expression with bind parameters can not be ordered by, use OrderExpression instead", slog.String("method", "OrderValidation"), slog.String("filter", f.Name), slog.String("db field", f.DbField))
+		return f.DbField
+	}
+	return sql
+}
+
+// OrderExpression works like OrderValidation but keeps the bind parameters of expression filters.
+// Use it with q.OrderByClause when ordering by a filter with an Expression.
+func OrderExpression(orderByStr string, orderDirectionStr string, filters []Filters) (sq.Sqlizer, error) {
+	orderDirection := strings.ToUpper(orderDirectionStr)
+	if orderDirection != "DESC" && orderDirection != "ASC" {
+		orderDirection = "ASC"
+	}
+
+	result, filter := IsFieldFilter(filters, strings.ToLower(orderByStr))
+	if !result || orderByStr == "" {
+		if len(filters) == 0 {
+			return nil, fmt.Errorf("no filters to order by")
+		}
+		filter = filters[0]
+	}
+
+	column, err := filter.ColumnExpr()
+	if err != nil {
+		return nil, err
+	}
+	sql, args, err := column.ToSql()
+	if err != nil {
+		return nil, err
+	}
+	return sq.Expr(fmt.Sprintf("%s %s", sql, orderDirection), args...), nil
+}
+
 // DatabaseValidation checks a database error and returns an appropriate
 // error message and status code that can be directly used in the response.
 // The underline error messaages is always logged.
 func DatabaseValidation(err error) (int, error) {
-	slog.LogAttrs(context.Background(), slog.LevelError, "database error",
+	return DatabaseValidationContext(context.Background(), err)
+}
+
+// DatabaseValidationContext works like DatabaseValidation and logs the error with ctx,
+// so it carries the request ID of the request (see RequestID & NewContextHandler)
+func DatabaseValidationContext(ctx context.Context, err error) (int, error) {
+	slog.LogAttrs(ctx, slog.LevelError, "database error",
 		slog.String("error", err.Error()),
 	)
 	if strings.Contains(err.Error(), "1062") {
@@ -116,6 +116,22 @@ func TestOrderValidation(t *testing.T) {
 			},
 			expected: "table.name ASC",
 		},
+		{
+			name:    "expression without bind parameters",
+			orderBy: "name",
+			filters: []Filters{
+				{Name: "name", Operator: "=", DbField: "table.name", Expression: NewFilterExpression("LOWER(table.name)")},
+			},
+			expected: "LOWER(table.name) ASC",
+		},
+		{
+			name:    "expression with bind parameters uses the db field",
+			orderBy: "name",
+			filters: []Filters{
+				{Name: "name", Operator: "=", DbField: "table.name", Expression: NewFilterExpression("similarity(table.name, ?)", "golf")},
+			},
+			expected: "table.name ASC",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {